@@ -0,0 +1,27 @@
+// Package profiling serves net/http/pprof for the worker and the load
+// generator.
+package profiling
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+)
+
+// Start serves net/http/pprof on addr in the background using its own mux, so
+// profiling is only reachable when -pprof-addr is set (never on the metrics
+// port). logPrefix is prepended to its log lines, e.g. "[Worker] ".
+func Start(addr, logPrefix string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	go func() {
+		log.Printf("%spprof listening on %s", logPrefix, addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("%spprof server stopped: %v", logPrefix, err)
+		}
+	}()
+}
@@ -0,0 +1,58 @@
+// Package readiness holds the connection checks the load generators run
+// before sending, so request timings never include channel setup or a worker
+// that is still starting.
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// WaitForReady forces the channel to connect and blocks until it is READY, so
+// channel setup is not counted in request timings.
+func WaitForReady(conn *grpc.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("channel still %s after %s", state, timeout)
+		}
+	}
+}
+
+// WaitForHealthy polls the standard gRPC health service until the worker
+// reports SERVING, so a run never starts against a worker that is not ready.
+func WaitForHealthy(conn *grpc.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	hc := healthpb.NewHealthClient(conn)
+	for {
+		checkCtx, checkCancel := context.WithTimeout(ctx, time.Second)
+		resp, err := hc.Check(checkCtx, &healthpb.HealthCheckRequest{})
+		checkCancel()
+		if err == nil && resp.Status == healthpb.HealthCheckResponse_SERVING {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("no SERVING status after %s: %w", timeout, err)
+			}
+			return fmt.Errorf("no SERVING status after %s: last status %s", timeout, resp.Status)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package stats holds the summary statistics shared by the worker and the
+// load generators, so every tool reports the same percentile for the same data.
+package stats
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// Stats summarizes a sample of values.
+type Stats struct {
+	Count  int
+	Mean   float64
+	StdDev float64
+	CoV    float64 // StdDev/Mean, 0 when Mean is 0
+	Min    float64
+	Max    float64
+	P25    float64
+	P50    float64
+	P75    float64
+	P95    float64
+	P99    float64
+	IQR    float64 // P75-P25
+}
+
+// Summary computes the Stats of values. values is not modified.
+func Summary(values []float64) Stats {
+	if len(values) == 0 {
+		return Stats{}
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	s := Stats{
+		Count:  len(sorted),
+		Mean:   Mean(sorted),
+		StdDev: StdDev(sorted),
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		P25:    percentileSorted(sorted, 25),
+		P50:    percentileSorted(sorted, 50),
+		P75:    percentileSorted(sorted, 75),
+		P95:    percentileSorted(sorted, 95),
+		P99:    percentileSorted(sorted, 99),
+	}
+	if s.Mean != 0 {
+		s.CoV = s.StdDev / s.Mean
+	}
+	s.IQR = s.P75 - s.P25
+	return s
+}
+
+// Percentile returns the p-th percentile (0-100) of values using the
+// nearest-rank method: the smallest value with at least p% of the sample at
+// or below it. It returns 0 for an empty sample. values is not modified.
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return percentileSorted(sorted, p)
+}
+
+func percentileSorted(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(0, min(idx, len(sorted)-1))]
+}
+
+// Mean returns the arithmetic mean of values, or 0 for an empty sample.
+func Mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// StdDev returns the population standard deviation of values, or 0 when
+// there are fewer than two values.
+func StdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	mean := Mean(values)
+	var sumSq float64
+	for _, v := range values {
+		d := v - mean
+		sumSq += d * d
+	}
+	return math.Sqrt(sumSq / float64(len(values)))
+}
+
+// ChiSquareUniform returns Pearson's chi-square statistic of counts against a
+// uniform split of their total, with len(counts)-1 degrees of freedom. It
+// returns 0 when there are fewer than two categories or no observations.
+func ChiSquareUniform(counts []int64) float64 {
+	if len(counts) < 2 {
+		return 0
+	}
+	var total int64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	expected := float64(total) / float64(len(counts))
+	var chi2 float64
+	for _, c := range counts {
+		d := float64(c) - expected
+		chi2 += d * d / expected
+	}
+	return chi2
+}
+
+// Interval is a confidence interval [Lo, Hi].
+type Interval struct {
+	Lo, Hi float64
+}
+
+// BootstrapPercentileCIs estimates a 95% confidence interval for each
+// percentile in ps by resampling values with replacement b times. The same
+// seed gives the same intervals. Each resample sorts len(values) elements, so
+// the cost is O(b * n log n).
+func BootstrapPercentileCIs(values []float64, ps []float64, b int, seed uint64) []Interval {
+	cis := make([]Interval, len(ps))
+	if len(values) == 0 || b <= 0 {
+		return cis
+	}
+
+	estimates := make([][]float64, len(ps))
+	for i := range estimates {
+		estimates[i] = make([]float64, b)
+	}
+	rng := rand.New(rand.NewPCG(seed, seed))
+	resample := make([]float64, len(values))
+	for r := range b {
+		for i := range resample {
+			resample[i] = values[rng.IntN(len(values))]
+		}
+		slices.Sort(resample)
+		for i, p := range ps {
+			estimates[i][r] = percentileSorted(resample, p)
+		}
+	}
+
+	for i, est := range estimates {
+		slices.Sort(est)
+		cis[i] = Interval{Lo: percentileSorted(est, 2.5), Hi: percentileSorted(est, 97.5)}
+	}
+	return cis
+}
+
+// Bucket is one histogram bin [Low, High) and the number of values in it.
+type Bucket struct {
+	Low, High float64
+	Count     int64
+}
+
+// LogHistogram bins values into log-spaced buckets, perDecade per power of 10,
+// with edges at 10^(k/perDecade). The buckets run contiguously from the one
+// holding the smallest value to the one holding the largest, empty ones
+// included. Non-positive values have no log bucket and are ignored.
+func LogHistogram(values []float64, perDecade int) []Bucket {
+	if perDecade < 1 {
+		return nil
+	}
+	edge := func(k int) float64 { return math.Pow(10, float64(k)/float64(perDecade)) }
+	counts := map[int]int64{}
+	first, last := math.MaxInt, math.MinInt
+	for _, v := range values {
+		if v <= 0 {
+			continue
+		}
+		k := int(math.Floor(math.Log10(v) * float64(perDecade)))
+		// Log10 rounding can put a value on an edge into the neighbouring bucket
+		if v < edge(k) {
+			k--
+		} else if v >= edge(k+1) {
+			k++
+		}
+		counts[k]++
+		first, last = min(first, k), max(last, k)
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	buckets := make([]Bucket, 0, last-first+1)
+	for k := first; k <= last; k++ {
+		buckets = append(buckets, Bucket{Low: edge(k), High: edge(k + 1), Count: counts[k]})
+	}
+	return buckets
+}
@@ -0,0 +1,243 @@
+package stats
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// oneToN returns 1, 2, ..., n.
+func oneToN(n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	return values
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{"1..100 p50", oneToN(100), 50, 50},
+		{"1..100 p95", oneToN(100), 95, 95},
+		{"1..100 p99", oneToN(100), 99, 99},
+		{"1..100 p100", oneToN(100), 100, 100},
+		{"1..100 p0", oneToN(100), 0, 1},
+		{"unsorted", []float64{5, 1, 4, 2, 3}, 40, 2},
+		{"n=1 p1", []float64{7}, 1, 7},
+		{"n=1 p99", []float64{7}, 99, 7},
+		{"empty", nil, 50, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Percentile(tt.values, tt.p); got != tt.want {
+				t.Errorf("Percentile(%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentileDoesNotModifyInput(t *testing.T) {
+	values := []float64{3, 1, 2}
+	Percentile(values, 50)
+	if values[0] != 3 || values[1] != 1 || values[2] != 2 {
+		t.Errorf("Percentile reordered its input: %v", values)
+	}
+}
+
+func TestMean(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{"empty", nil, 0},
+		{"one", []float64{4}, 4},
+		{"1..100", oneToN(100), 50.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Mean(tt.values); got != tt.want {
+				t.Errorf("Mean = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStdDev(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{"empty", nil, 0},
+		{"one", []float64{42}, 0},
+		{"constant", []float64{3, 3, 3}, 0},
+		{"population", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StdDev(tt.values); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("StdDev = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []float64
+		wantCoV float64
+		wantIQR float64
+	}{
+		{"empty", nil, 0, 0},
+		{"1..100", oneToN(100), math.Sqrt(9999.0/12) / 50.5, 50},
+		{"zero mean", []float64{-1, 1}, 0, 2},
+		{"constant", []float64{5, 5, 5, 5}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Summary(tt.values)
+			if s.Count != len(tt.values) {
+				t.Errorf("Count = %d, want %d", s.Count, len(tt.values))
+			}
+			if math.Abs(s.CoV-tt.wantCoV) > 1e-12 {
+				t.Errorf("CoV = %v, want %v", s.CoV, tt.wantCoV)
+			}
+			if s.IQR != tt.wantIQR {
+				t.Errorf("IQR = %v, want %v", s.IQR, tt.wantIQR)
+			}
+		})
+	}
+}
+
+func TestSummaryPercentilesMatchPercentile(t *testing.T) {
+	values := []float64{9, 2, 7, 4, 1, 8, 3, 6, 5, 10}
+	s := Summary(values)
+	for _, c := range []struct {
+		p   float64
+		got float64
+	}{{25, s.P25}, {50, s.P50}, {75, s.P75}, {95, s.P95}, {99, s.P99}} {
+		if want := Percentile(values, c.p); c.got != want {
+			t.Errorf("Summary P%v = %v, Percentile = %v", c.p, c.got, want)
+		}
+	}
+	if s.Min != 1 || s.Max != 10 {
+		t.Errorf("Min/Max = %v/%v, want 1/10", s.Min, s.Max)
+	}
+}
+
+func TestBootstrapPercentileCIsReproducible(t *testing.T) {
+	values := oneToN(500)
+	ps := []float64{50, 95, 99}
+
+	a := BootstrapPercentileCIs(values, ps, 200, 7)
+	b := BootstrapPercentileCIs(values, ps, 200, 7)
+	if !slices.Equal(a, b) {
+		t.Errorf("same seed gave different intervals: %v vs %v", a, b)
+	}
+	if c := BootstrapPercentileCIs(values, ps, 200, 8); slices.Equal(a, c) {
+		t.Errorf("seeds 7 and 8 gave identical intervals: %v", a)
+	}
+}
+
+func TestBootstrapPercentileCIsContainEstimate(t *testing.T) {
+	values := oneToN(1000)
+	ps := []float64{25, 50, 95, 99}
+	cis := BootstrapPercentileCIs(values, ps, 500, 1)
+	for i, p := range ps {
+		est := Percentile(values, p)
+		if cis[i].Lo > est || est > cis[i].Hi {
+			t.Errorf("P%v = %v outside its interval [%v, %v]", p, est, cis[i].Lo, cis[i].Hi)
+		}
+	}
+}
+
+func TestBootstrapPercentileCIsDegenerate(t *testing.T) {
+	ps := []float64{50, 99}
+	tests := []struct {
+		name   string
+		values []float64
+		b      int
+		want   []Interval
+	}{
+		{"empty", nil, 100, []Interval{{}, {}}},
+		{"no resamples", oneToN(10), 0, []Interval{{}, {}}},
+		{"one sample", []float64{3}, 100, []Interval{{3, 3}, {3, 3}}},
+		{"constant", []float64{2, 2, 2}, 100, []Interval{{2, 2}, {2, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BootstrapPercentileCIs(tt.values, ps, tt.b, 1); !slices.Equal(got, tt.want) {
+				t.Errorf("BootstrapPercentileCIs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChiSquareUniform(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts []int64
+		want   float64
+	}{
+		{"even split", []int64{25, 25, 25, 25}, 0},
+		// expected 20 each: (30-20)²/20 + (10-20)²/20 + 0 = 10
+		{"skewed", []int64{30, 10, 20}, 10},
+		// expected 50 each: 2 * (40-50)²/50 = 4
+		{"two buckets", []int64{60, 40}, 4},
+		{"no observations", []int64{0, 0, 0}, 0},
+		{"one bucket", []int64{100}, 0},
+		{"no buckets", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ChiSquareUniform(tt.counts); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("ChiSquareUniform(%v) = %v, want %v", tt.counts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogHistogram(t *testing.T) {
+	got := LogHistogram([]float64{1, 5, 9.99, 10, 1000, 0, -3}, 1)
+	want := []Bucket{{1, 10, 3}, {10, 100, 1}, {100, 1000, 0}, {1000, 10000, 1}}
+	if len(got) != len(want) {
+		t.Fatalf("LogHistogram = %v, want %v", got, want)
+	}
+	for i := range want {
+		if math.Abs(got[i].Low-want[i].Low) > 1e-9 || math.Abs(got[i].High-want[i].High) > 1e-9 || got[i].Count != want[i].Count {
+			t.Errorf("bucket %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLogHistogramEdges(t *testing.T) {
+	// With 10 buckets per decade every value 10^(k/10) is a lower edge
+	for k := -20; k <= 60; k++ {
+		v := math.Pow(10, float64(k)/10)
+		b := LogHistogram([]float64{v}, 10)
+		if len(b) != 1 || v < b[0].Low || v >= b[0].High {
+			t.Errorf("LogHistogram(%v) = %v, want one bucket holding it", v, b)
+		}
+	}
+}
+
+func TestLogHistogramCountsEveryPositiveValue(t *testing.T) {
+	values := oneToN(1000)
+	var total int64
+	for _, b := range LogHistogram(values, 10) {
+		total += b.Count
+	}
+	if total != 1000 {
+		t.Errorf("histogram holds %d values, want 1000", total)
+	}
+	if LogHistogram(nil, 10) != nil || LogHistogram([]float64{0, -1}, 10) != nil {
+		t.Errorf("LogHistogram without positive values should be nil")
+	}
+}
@@ -2,27 +2,62 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"fyp-onboarding/internal/profiling"
+	"fyp-onboarding/internal/readiness"
+	"fyp-onboarding/internal/stats"
+	"fyp-onboarding/internal/tracing"
 	pb "fyp-onboarding/workerpb"
+	"io"
 	"log"
+	"maps"
 	"math"
 	"math/rand"
+	"net"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	grpcstats "google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
 
 	"net/http"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// ---------------- Prometheus Metric ----------------
+var tracer = otel.Tracer("fyp-onboarding/loadgen")
+
+// ---------------- Prometheus Metrics ----------------
 var totalRequests = prometheus.NewCounter(
 	prometheus.CounterOpts{
 		Name: "loadgen_total_requests",
@@ -30,31 +65,240 @@ var totalRequests = prometheus.NewCounter(
 	},
 )
 
+var clientE2ELatency = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "loadgen_client_e2e_latency_ms",
+		Help:    "Client-observed end-to-end latency of successful requests in milliseconds",
+		Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 750, 1000, 1500, 2000, 5000, 10000},
+	},
+	[]string{"distribution", "rps"},
+)
+
+// Sparse, high-resolution counterpart of clientE2ELatency for server-side
+// quantiles. Only exposed over the protobuf exposition format, so Prometheus
+// must scrape with native histograms enabled.
+var clientE2ELatencyNative = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:                            "loadgen_client_e2e_latency_native_ms",
+		Help:                            "Client-observed end-to-end latency of successful requests in milliseconds (native histogram)",
+		NativeHistogramBucketFactor:     1.1,
+		NativeHistogramMaxBucketNumber:  160,
+		NativeHistogramMinResetDuration: time.Hour,
+	},
+)
+
+var timeoutsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "loadgen_timeouts_total",
+		Help: "Total number of timed-out requests by reason",
+	},
+	[]string{"reason"},
+)
+
+var retriesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "loadgen_retries_total",
+		Help: "Total number of retried request attempts by the status code that failed",
+	},
+	[]string{"code"},
+)
+
 // ---------------- Batch Result Struct ----------------
 type batchResult struct {
 	workerE2E     int64
 	clientE2E     int64
 	avgCpuFreqKhz int64
+	cpuFreqOK     bool // worker could read cpufreq; avgCpuFreqKhz is meaningless otherwise
 	iterations    int64
 	// High-precision network metrics
 	clientSendNs       int64 // Client send timestamp (ns)
 	clientRecvNs       int64 // Client receive timestamp (ns)
 	networkLatencyNs   int64 // Pure network latency (total - worker processing)
 	workerProcessingNs int64 // Worker-reported processing time
-	dataPlaneLatencyNs int64 // Estimated one-way data plane latency
+	dataPlaneLatencyNs int64 // One-way request-path latency (measured if clock-synced, else network/2)
+	responsePathNs     int64 // One-way response-path latency (measured if clock-synced, else network/2)
+}
+
+// BatchAverages are the per-request averages of a batch of successful requests,
+// as written to the run log every 20s and at the end of a run.
+type BatchAverages struct {
+	Requests           int
+	WorkerE2EMs        float64
+	ClientE2EMs        float64
+	NetworkLatencyUs   float64
+	DataPlaneLatencyUs float64
+	ResponsePathUs     float64
+	JitterUs           float64
+	WorkerProcessingMs float64
+	AvgCPUFreqKhz      float64 // over CPUFreqSamples requests only
+	CPUFreqSamples     int     // requests whose worker could read cpufreq
+	AvgIterations      float64
+}
+
+// RunResult summarizes one RunExperiment call for the caller.
+type RunResult struct {
+	RunID          string
+	TotalRequests  int64
+	Timeouts       int64
+	TimeoutRatePct float64
+	AchievedRPS    float64
+	StoppedEarly   bool          // aborted because more than -max-error-rate of recent requests failed
+	Interrupted    bool          // cut short by Ctrl+C; the figures cover the requests sent before it
+	ClientE2E      stats.Stats   // client E2E latency of successful requests, in ms
+	CorrectedE2E   stats.Stats   // open loop: ClientE2E measured from the intended send time
+	Network        stats.Stats   // ClientE2E minus worker processing, in ms
+	Retries        int64         // attempts beyond the first, of any request
+	RetriedOK      int64         // requests that succeeded only after a retry
+	ColdE2E        stats.Stats   // -fresh-conn: connect plus DoWork of successful requests, in ms
+	FinalBatch     BatchAverages // averages of the requests since the last 20s batch
+}
+
+// runLabels are the repeatable -label key=value pairs annotating every run,
+// e.g. the kernel or node type, kept in the order given.
+type runLabels []runLabel
+
+type runLabel struct {
+	key, value string
+}
+
+// labelKeyPattern keeps keys usable as Prometheus label names.
+var labelKeyPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabelKeys are the pushgateway grouping keys pushRunSummary sets
+// itself; a -label with one of them would overwrite the run's own grouping.
+var reservedLabelKeys = []string{"rps", "duration_ms", "distribution", "job"}
+
+func (l *runLabels) String() string {
+	pairs := make([]string, len(*l))
+	for i, p := range *l {
+		pairs[i] = p.key + "=" + p.value
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l *runLabels) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || value == "" {
+		return fmt.Errorf("want key=value, got %q", s)
+	}
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("label key %q must match %s", key, labelKeyPattern)
+	}
+	if slices.Contains(reservedLabelKeys, key) {
+		return fmt.Errorf("label key %q is reserved; %s are set from the run itself", key, strings.Join(reservedLabelKeys, ", "))
+	}
+	if strings.ContainsAny(value, `/\`) {
+		return fmt.Errorf("label value %q must not contain path separators", value)
+	}
+	*l = append(*l, runLabel{key, value})
+	return nil
+}
+
+// clockEstimate is the NTP-style estimate of the worker clock relative to ours:
+// workerClock = clientClock + offsetNs.
+type clockEstimate struct {
+	offsetNs int64
+	rttNs    int64 // network round trip of the best (lowest-delay) ping
 }
 
+// maxPadBytes keeps padded messages under gRPC's default 4 MiB message limit,
+// matching the worker's maxResponsePad.
+const maxPadBytes = 4<<20 - 64<<10
+
 const WARMUPMIN = 1
 const EXPMIN = 2
 
-// ---------------- Experiment Runner ----------------
-func RunExperiment(client pb.WorkerServiceClient, rps int, durationMs int32, distribution string, workMode string, proxyMode string, experimentName string) {
-	fmt.Printf("Running Experiment with RPS=%d, DUR=%d, WorkMode=%s, ProxyMode=%s\n", rps, durationMs, workMode, proxyMode)
+// minRequestTimeout is the shortest DoWork deadline, for requests with little
+// or no work.
+const minRequestTimeout = time.Second
+
+// interruptDrain is how long an interrupted run waits for requests in flight
+// before canceling them.
+const interruptDrain = 5 * time.Second
+
+// runConfig is everything one RunExperiment call needs besides the connections.
+// rps, durationMs and distribution change per run of the sweep; the rest is
+// fixed by flags for the whole sweep.
+type runConfig struct {
+	rps          int
+	durationMs   int32
+	distribution string // "uniform" or "poisson"; "closed" in closed-loop mode
+
+	closedLoop         bool // one request in flight per connection, sent as soon as the last returns; rps is unused
+	warmup             time.Duration
+	warmupRequests     int // if > 0, the warmup phase is this many requests instead of warmup long
+	experiment         time.Duration
+	workMode           string
+	proxyMode          string
+	experimentName     string
+	requestPadBytes    int
+	responsePadBytes   int
+	targetUtilPct      int
+	clock              *clockEstimate // nil when clock sync is off
+	pushgatewayURL     string
+	influxURL          string // InfluxDB to write each run's summary point to, "" disables
+	influxBucket       string
+	influxOrg          string
+	bootstrapResamples int
+	bootstrapSeed      uint64
+	seed               int64
+	labels             runLabels
+	histCSV            bool
+	rampTo             int           // if > 0, the rate moves from rps to rampTo over the experiment phase
+	rampSteps          int           // ramp in this many equal steps; 0 ramps linearly
+	abBatch            time.Duration // if > 0, A/B mode: switch between the two targets every abBatch
+	targetP99Ms        float64       // if > 0, an AIMD controller adjusts the rate, starting at rps, to keep P99 under this
+	aimdWindow         time.Duration // AIMD: P99 is measured and the rate adjusted once per window
+	aimdStep           float64       // AIMD: RPS added after a window under the target
+	aimdBackoff        float64       // AIMD: factor the rate is multiplied by after a window over the target
+	baseline           *baseline     // nil unless -baseline is set
+	profile            workProfile   // if set, each request's DurationMs is drawn from it instead of durationMs
+	maxRetries         int           // retries of an Unavailable or DeadlineExceeded request, 0 disables
+	retryBudget        float64       // most retries may make up of all attempts, 0-1
+	timeseriesWindow   time.Duration // if > 0, write latency percentiles per window of this length to <runID>_timeseries.csv
+	freshConn          bool          // send every request on a new connection, to measure the cold path
+	maxErrorRate       float64       // stop the run once more than this fraction of the last errorWindow requests failed, 0 disables
+	errorWindow        int           // requests the error rate is measured over, and the fewest before stopping
+}
 
+// ---------------- Experiment Runner ----------------
+// RunExperiment runs one point of the sweep. Open-loop requests go to a
+// random one of targets; closed loop uses only targets[0]. Canceling ctx
+// interrupts the run: no new requests are sent, requests still in flight after
+// interruptDrain are canceled, and the summary covers what was sent.
+func RunExperiment(ctx context.Context, targets []*connPool, cfg runConfig) RunResult {
+	pool := targets[0]
 	runStart := time.Now()
-	runID := fmt.Sprintf("RPS%d_Dur%d_%s_WM-%s_PM-%s_%s", rps, durationMs, distribution, workMode, proxyMode, time.Now().Format("150405"))
-	if experimentName != "" {
-		runID = fmt.Sprintf("%s_%s", experimentName, runID)
+	runID := fmt.Sprintf("RPS%d_Dur%d_%s_WM-%s_PM-%s", cfg.rps, cfg.durationMs, cfg.distribution, cfg.workMode, cfg.proxyMode)
+	if cfg.targetP99Ms > 0 {
+		fmt.Printf("Running AIMD Experiment with target P99=%.3f ms from RPS=%d, DUR=%d, WorkMode=%s, ProxyMode=%s\n", cfg.targetP99Ms, cfg.rps, cfg.durationMs, cfg.workMode, cfg.proxyMode)
+		runID = fmt.Sprintf("AIMD%gms_Dur%d_%s_WM-%s_PM-%s", cfg.targetP99Ms, cfg.durationMs, cfg.distribution, cfg.workMode, cfg.proxyMode)
+	} else if cfg.rampTo > 0 {
+		fmt.Printf("Running ramp Experiment with RPS=%d->%d, DUR=%d, WorkMode=%s, ProxyMode=%s\n", cfg.rps, cfg.rampTo, cfg.durationMs, cfg.workMode, cfg.proxyMode)
+		runID = fmt.Sprintf("Ramp%d-%d_Dur%d_%s_WM-%s_PM-%s", cfg.rps, cfg.rampTo, cfg.durationMs, cfg.distribution, cfg.workMode, cfg.proxyMode)
+	} else if cfg.closedLoop {
+		fmt.Printf("Running closed-loop Experiment with Connections=%d, DUR=%d, WorkMode=%s, ProxyMode=%s\n", len(pool.conns), cfg.durationMs, cfg.workMode, cfg.proxyMode)
+		runID = fmt.Sprintf("Closed%d_Dur%d_WM-%s_PM-%s", len(pool.conns), cfg.durationMs, cfg.workMode, cfg.proxyMode)
+	} else {
+		fmt.Printf("Running Experiment with RPS=%d, DUR=%d, WorkMode=%s, ProxyMode=%s\n", cfg.rps, cfg.durationMs, cfg.workMode, cfg.proxyMode)
+	}
+	if cfg.profile != nil {
+		// DUR above is a placeholder; durations come from the profile
+		fmt.Printf("Request durations drawn from work profile %s\n", cfg.profile)
+		runID = strings.Replace(runID, fmt.Sprintf("_Dur%d_", cfg.durationMs), "_Mix-"+cfg.profile.String()+"_", 1)
+	}
+	for _, l := range cfg.labels {
+		runID += fmt.Sprintf("_%s-%s", l.key, l.value)
+	}
+	if cfg.abBatch > 0 {
+		runID += "_AB"
+	}
+	if cfg.freshConn {
+		runID += "_Fresh"
+	}
+	runID += "_" + time.Now().Format("150405")
+	if cfg.experimentName != "" {
+		runID = fmt.Sprintf("%s_%s", cfg.experimentName, runID)
 	}
 	logFile := fmt.Sprintf("logs/%s.log", runID)
 	os.MkdirAll("logs", os.ModePerm)
@@ -64,72 +308,121 @@ func RunExperiment(client pb.WorkerServiceClient, rps int, durationMs int32, dis
 	}
 	defer f.Close()
 	logger := log.New(f, "", log.LstdFlags)
+	logger.Printf("Payload: RequestPadBytes=%d, ResponsePadBytes=%d", cfg.requestPadBytes, cfg.responsePadBytes)
+	logger.Printf("Seed: %d (replay with -seed %d)", cfg.seed, cfg.seed)
+	if cfg.abBatch > 0 {
+		logger.Printf("A/B targets: direct %s, VIP %s, switching every %s, %d connections each", targets[0].target, targets[1].target, cfg.abBatch, len(pool.conns))
+	} else if len(targets) > 1 {
+		logger.Printf("Targets: %d VIPs with %d connections each, one picked at random per request", len(targets), len(pool.conns))
+	} else {
+		logger.Printf("Connections: %d", len(pool.conns))
+	}
+	if len(cfg.labels) > 0 {
+		logger.Printf("Labels: %s", cfg.labels.String())
+	}
+
+	// All arrival randomness comes from this run's generator so a seed replays exactly
+	rng := rand.New(rand.NewSource(cfg.seed))
+	if cfg.clock != nil {
+		logger.Printf("One-way latency: measured with clock offset %.1f µs (ping RTT %.1f µs)", float64(cfg.clock.offsetNs)/1e3, float64(cfg.clock.rttNs)/1e3)
+	} else {
+		logger.Printf("One-way latency: estimated as network latency / 2 (no clock sync)")
+	}
+
+	// pickTarget draws the target of the next request; the draw is skipped for a
+	// single target so seeds recorded before -vip-list still replay the same arrivals.
+	// A/B mode takes the targets in turn for abBatch each, so slow drift over the
+	// run affects both alike.
+	pickTarget := func() int {
+		if cfg.abBatch > 0 {
+			return int(time.Since(runStart)/cfg.abBatch) % len(targets)
+		}
+		if len(targets) == 1 {
+			return 0
+		}
+		return rng.Intn(len(targets))
+	}
+
+	// Padding is allocated once and shared by every request of the run
+	requestPad := make([]byte, cfg.requestPadBytes)
+	newRequest := func(id string, durationMs int32) *pb.WorkRequest {
+		return &pb.WorkRequest{
+			DurationMs:      durationMs,
+			WorkMode:        cfg.workMode,
+			Id:              id,
+			RequestPadBytes: requestPad,
+			ResponsePadSize: int32(cfg.responsePadBytes),
+			TargetUtilPct:   int32(cfg.targetUtilPct),
+		}
+	}
+
+	// Requests time out at 20x their work, but no sooner than minRequestTimeout
+	// so no-work requests are not failed before they can be answered
+	requestTimeout := func(durationMs int32) time.Duration {
+		return max(time.Duration(durationMs)*20*time.Millisecond, minRequestTimeout)
+	}
+	// drawDuration picks the DurationMs of the next request
+	drawDuration := func(rng *rand.Rand) int32 {
+		if cfg.profile == nil {
+			return cfg.durationMs
+		}
+		return cfg.profile.sample(rng)
+	}
 
 	var wg sync.WaitGroup
 	var ticker *time.Ticker
-	if distribution == "uniform" {
-		ticker = time.NewTicker(time.Second / time.Duration(rps))
+	if cfg.distribution == "uniform" {
+		ticker = time.NewTicker(time.Second / time.Duration(cfg.rps))
 		defer ticker.Stop()
 	}
 
 	var reqCount int64
 	var timeoutCount int64
+	var attemptCount, retryCount, retriedOKCount int64 // -max-retries: DoWork calls, those that were retries, requests saved by them
 	batchResults := []batchResult{}
 	var batchMutex sync.Mutex
+	var clientE2EMs []float64          // every successful request of the run, for percentiles
+	perInstance := map[string]int64{}  // successful requests per serving worker replica
+	perNode := map[string]int64{}      // successful requests per node of the serving replica
+	failures := map[codes.Code]int64{} // failed requests per gRPC status code
+	var sentBytes, recvBytes int64     // serialized request/response sizes of successful requests
+	// Open loop: latency from when each successful request was due rather than
+	// sent, so a stalled worker or generator cannot hide the requests it delayed
+	// (coordinated omission)
+	var correctedE2EMs []float64
+	perTargetE2EMs := make([][]float64, len(targets)) // clientE2EMs split by target
+	perTargetFailed := make([]int64, len(targets))    // failed requests split by target
+	var rampSamples []rampSample                      // ramp: every successful request with the rate it was sent at
+	var aimdWindowMs []float64                        // AIMD: latency of requests completed in the current window, +Inf if failed
+	var aimdTrajectory []aimdPoint
+	var networkMs []float64                // round trip minus worker processing of every successful request
+	perClassE2EMs := map[int32][]float64{} // work profile: clientE2EMs split by DurationMs
+	var retriedE2EMs []float64             // retried successes, from the first attempt's send to the final receive
+	var timeSamples []timeSample           // -timeseries-window: every successful request by when it was sent
+	var coldE2EMs, connectMs []float64     // -fresh-conn: connect plus DoWork, and connect alone, of successful requests
+	// clientE2EMs split by connection of targets[0], to see whether one connection is slower
+	perConnE2EMs := make([][]float64, len(pool.clients))
 
 	batchTicker := time.NewTicker(20 * time.Second)
 	defer batchTicker.Stop()
 	done := make(chan struct{})
 
-	// Log batch averages every 20s
+	// Log batch averages every 20s, with the worker's conntrack occupancy alongside
+	var pollNodeStats atomic.Bool
+	pollNodeStats.Store(true)
 	go func() {
 		for {
 			select {
 			case <-batchTicker.C:
 				batchMutex.Lock()
 				if len(batchResults) > 0 {
-					var sumWorker, sumClient, sumFreq, sumIter int64
-					var sumNetworkLatency, sumDataPlane, sumWorkerProcessing int64
-					var networkLatencies, dataPlaneLatencies []int64
-
-					for _, r := range batchResults {
-						sumWorker += r.workerE2E
-						sumClient += r.clientE2E
-						sumFreq += r.avgCpuFreqKhz
-						sumIter += r.iterations
-						sumNetworkLatency += r.networkLatencyNs
-						sumDataPlane += r.dataPlaneLatencyNs
-						sumWorkerProcessing += r.workerProcessingNs
-						networkLatencies = append(networkLatencies, r.networkLatencyNs)
-						dataPlaneLatencies = append(dataPlaneLatencies, r.dataPlaneLatencyNs)
-					}
-
-					n := float64(len(batchResults))
-					avgWorker := float64(sumWorker) / n
-					avgClient := float64(sumClient) / n
-					avgFreq := float64(sumFreq) / n
-					avgIter := float64(sumIter) / n
-					avgNetworkLatencyUs := float64(sumNetworkLatency) / n / 1000.0
-					avgDataPlaneUs := float64(sumDataPlane) / n / 1000.0
-					avgWorkerProcessingMs := float64(sumWorkerProcessing) / n / 1e6
-
-					// Calculate jitter (standard deviation)
-					var sumSqDiff float64
-					meanDataPlane := float64(sumDataPlane) / n
-					for _, val := range dataPlaneLatencies {
-						diff := float64(val) - meanDataPlane
-						sumSqDiff += diff * diff
-					}
-					jitterUs := 0.0
-					if len(dataPlaneLatencies) > 1 {
-						jitterUs = math.Sqrt(sumSqDiff/float64(len(dataPlaneLatencies))) / 1000.0
-					}
-
-					logger.Printf("20s Batch Avg (last %d reqs): WorkerE2E=%.2f ms, ClientE2E=%.2f ms, NetworkLatency=%.2f µs, DataPlaneLatency=%.2f µs, Jitter=%.2f µs, WorkerProcessing=%.3f ms, AvgCPUFreq=%.2f kHz, AvgIterations=%.0f",
-						len(batchResults), avgWorker, avgClient, avgNetworkLatencyUs, avgDataPlaneUs, jitterUs, avgWorkerProcessingMs, avgFreq, avgIter)
+					logBatch(logger, "20s Batch Avg", averageBatch(batchResults))
 					batchResults = []batchResult{}
 				}
 				batchMutex.Unlock()
+				if pollNodeStats.Load() {
+					pollNodeStats.Store(logNodeStats(pool.client(), logger))
+				}
 			case <-done:
 				return
 			}
@@ -137,200 +430,2141 @@ func RunExperiment(client pb.WorkerServiceClient, rps int, durationMs int32, dis
 	}()
 
 	// --- Warmup Phase ---
-	fmt.Printf("Warmup for %d minutes (discarding results)...\n", WARMUPMIN)
-	warmupEnd := time.Now().Add(time.Duration(WARMUPMIN) * time.Minute)
-	for time.Now().Before(warmupEnd) {
-		if distribution == "uniform" {
+	warmupEnd := time.Now().Add(cfg.warmup)
+	var warmupSent int64
+	// warmupMore claims the next warmup request: the phase lasts cfg.warmup,
+	// or exactly cfg.warmupRequests requests if that is set
+	warmupMore := func() bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		if cfg.warmupRequests > 0 {
+			return atomic.AddInt64(&warmupSent, 1) <= int64(cfg.warmupRequests)
+		}
+		return time.Now().Before(warmupEnd)
+	}
+	if cfg.warmupRequests > 0 {
+		fmt.Printf("Warmup for %d requests (discarding results)...\n", cfg.warmupRequests)
+	} else {
+		fmt.Printf("Warmup for %s (discarding results)...\n", cfg.warmup)
+	}
+	if cfg.closedLoop {
+		var warmupWG sync.WaitGroup
+		for conn, client := range pool.clients {
+			warmupWG.Add(1)
+			go func() {
+				defer warmupWG.Done()
+				connRng := rand.New(rand.NewSource(cfg.seed - int64(conn) - 1))
+				for warmupMore() {
+					d := drawDuration(connRng)
+					ctx, cancel := context.WithTimeout(context.Background(), requestTimeout(d))
+					_, _ = client.DoWork(ctx, newRequest("", d))
+					cancel()
+				}
+			}()
+		}
+		warmupWG.Wait()
+	}
+	for !cfg.closedLoop && warmupMore() {
+		if cfg.distribution == "uniform" {
 			<-ticker.C
 		} else {
-			meanInterval := float64(time.Second) / float64(rps)
-			time.Sleep(time.Duration(rand.ExpFloat64() * meanInterval))
+			meanInterval := float64(time.Second) / float64(cfg.rps)
+			time.Sleep(time.Duration(rng.ExpFloat64() * meanInterval))
 		}
+		target, d := targets[pickTarget()], drawDuration(rng)
 		go func() {
-			_, _ = client.DoWork(context.Background(), &pb.WorkRequest{DurationMs: durationMs, WorkMode: workMode})
+			_, _ = target.client().DoWork(context.Background(), newRequest("", d))
 		}()
 	}
 
 	// --- Experiment Phase ---
-	fmt.Printf("Running experiment for %d minutes...\n", EXPMIN)
-	expEnd := time.Now().Add(time.Duration(EXPMIN) * time.Minute)
+	fmt.Printf("Running experiment for %s...\n", cfg.experiment)
+	expStart := time.Now()
+	expEnd := expStart.Add(cfg.experiment)
 	expCtx, expCancel := context.WithCancel(context.Background())
 	defer expCancel()
+	stopDrain := context.AfterFunc(ctx, func() {
+		fmt.Printf("Interrupted: waiting up to %s for requests in flight...\n", interruptDrain)
+		time.AfterFunc(interruptDrain, expCancel)
+	})
+	defer stopDrain()
 
 	stopEarly := int32(0)
-
-	for time.Now().Before(expEnd) && atomic.LoadInt32(&stopEarly) == 0 {
-		if distribution == "uniform" {
-			<-ticker.C
-		} else {
-			meanInterval := float64(time.Second) / float64(rps)
-			time.Sleep(time.Duration(rand.ExpFloat64() * meanInterval))
+	recent := newErrorWindow(cfg.errorWindow) // guarded by batchMutex
+	// recordOutcome feeds a completed request to the rolling error rate and
+	// stops the run once it is over cfg.maxErrorRate, so a broken setup does
+	// not run to the end; the summary then covers the requests sent so far
+	recordOutcome := func(failed bool) {
+		if cfg.maxErrorRate <= 0 || expCtx.Err() != nil {
+			return // failures of requests cut short by a stop are not the worker's
+		}
+		batchMutex.Lock()
+		rate, full := recent.add(failed)
+		batchMutex.Unlock()
+		if full && rate > cfg.maxErrorRate && atomic.CompareAndSwapInt32(&stopEarly, 0, 1) {
+			logger.Printf("Stopping early: %.1f%% of the last %d requests failed (-max-error-rate %.1f%%)", 100*rate, cfg.errorWindow, 100*cfg.maxErrorRate)
+			fmt.Printf("Stopping early: %.1f%% of the last %d requests failed; summarizing the requests sent so far\n", 100*rate, cfg.errorWindow)
+			expCancel()
 		}
+	}
+	rpsLabel := strconv.Itoa(cfg.rps)
 
-		newReqID := atomic.AddInt64(&reqCount, 1)
-		totalRequests.Inc() // Prometheus metric
+	// Observed inter-arrival process (dispatch loop is single-threaded, no locking needed)
+	var prevDispatch time.Time
+	var intervalCount int64
+	var sumInterval, sumSqInterval float64
 
-		wg.Add(1)
-		go func(idx int64) {
-			defer wg.Done()
+	// takeRetry reserves a retry if that keeps retries within cfg.retryBudget
+	// of all attempts, so a broken worker is not hit with maxRetries times the load
+	takeRetry := func() bool {
+		for {
+			retries, attempts := atomic.LoadInt64(&retryCount), atomic.LoadInt64(&attemptCount)
+			if !withinRetryBudget(retries+1, attempts+1, cfg.retryBudget) {
+				return false
+			}
+			if atomic.CompareAndSwapInt64(&retryCount, retries, retries+1) {
+				return true
+			}
+		}
+	}
 
+	// send makes one request of durationMs work on connection conn and records
+	// its result. intendedNs and rps are when an open-loop request was due and
+	// the rate it was sent at, 0 in closed loop.
+	send := func(target, conn int, idx int64, durationMs int32, intendedNs int64, rps float64) {
+		reqID := strconv.FormatInt(idx, 10)
+		req := newRequest(reqID, durationMs)
+
+		// Retried attempts are timed on their own; firstSendNs keeps the
+		// request's overall start
+		firstSendNs := time.Now().UnixNano()
+		var sendTime time.Time
+		var resp *pb.WorkResponse
+		var err, ctxErr error
+		var connectNs int64
+		attempt := 0
+		for ; ; attempt++ {
+			client := targets[target].clients[conn]
+			var fresh *grpc.ClientConn
+			err = nil
+			if cfg.freshConn {
+				// Cold path: connect first, so the send timestamp below still
+				// times DoWork alone and connectNs the new flow's setup
+				connectStart := time.Now()
+				fresh, err = targets[target].dialFresh(requestTimeout(durationMs))
+				connectNs = time.Since(connectStart).Nanoseconds()
+				if err == nil {
+					client = pb.NewWorkerServiceClient(fresh)
+				}
+			}
 			// High-precision timing: capture send timestamp
-			sendTime := time.Now()
-			sendNs := sendTime.UnixNano()
+			sendTime = time.Now()
+			ctx, cancel := context.WithTimeout(expCtx, requestTimeout(durationMs))
+			atomic.AddInt64(&attemptCount, 1)
+			if err == nil {
+				resp, err = client.DoWork(ctx, req)
+			}
+			ctxErr = ctx.Err()
+			cancel()
+			if fresh != nil {
+				fresh.Close()
+			}
+			if err == nil || attempt >= cfg.maxRetries || !retryable(err) || expCtx.Err() != nil || !takeRetry() {
+				break
+			}
+			retriesTotal.WithLabelValues(status.Code(err).String()).Inc()
+			select {
+			case <-time.After(retryBackoff(attempt)):
+			case <-expCtx.Done():
+			}
+		}
+		sendNs := sendTime.UnixNano()
+
+		// High-precision timing: capture receive timestamp
+		recvTime := time.Now()
+		recvNs := recvTime.UnixNano()
+		e2e := time.Since(sendTime).Milliseconds()
+
+		if err != nil {
+			logger.Printf("Request %s failed: %v", reqID, err)
+			batchMutex.Lock()
+			failures[status.Code(err)]++
+			perTargetFailed[target]++
+			if cfg.targetP99Ms > 0 {
+				aimdWindowMs = append(aimdWindowMs, math.Inf(1)) // a failure misses any latency target
+			}
+			batchMutex.Unlock()
+			if ctxErr == context.DeadlineExceeded {
+				atomic.AddInt64(&timeoutCount, 1)
+				timeoutsTotal.WithLabelValues("client_deadline").Inc()
+			} else if status.Code(err) == codes.DeadlineExceeded {
+				timeoutsTotal.WithLabelValues("server_deadline").Inc()
+			} else if ctxErr == context.Canceled {
+				timeoutsTotal.WithLabelValues("canceled").Inc()
+			}
+			recordOutcome(true)
+			return
+		}
+		recordOutcome(false)
 
-			timeout := time.Duration(durationMs) * 20 * time.Millisecond
-			ctx, cancel := context.WithTimeout(expCtx, timeout)
-			defer cancel()
+		clientE2ELatency.WithLabelValues(cfg.distribution, rpsLabel).Observe(float64(recvNs-sendNs) / 1e6)
+		clientE2ELatencyNative.Observe(float64(recvNs-sendNs) / 1e6)
 
-			resp, err := client.DoWork(ctx, &pb.WorkRequest{DurationMs: durationMs, WorkMode: workMode})
+		// Calculate network-specific metrics
+		clientRoundTripNs := recvNs - sendNs
+		workerProcessingNs := resp.WorkerProcessingNs
+		networkLatencyNs := clientRoundTripNs - workerProcessingNs
+		// Approximate one-way data plane latency (divide by 2 for request + response path)
+		dataPlaneLatencyNs := networkLatencyNs / 2
+		responsePathNs := networkLatencyNs - dataPlaneLatencyNs
+		if cfg.clock != nil {
+			// Map worker timestamps into the client clock to split the two paths
+			dataPlaneLatencyNs = resp.ArrivalTimestampNs - cfg.clock.offsetNs - sendNs
+			responsePathNs = recvNs - (resp.ResponseTimestampNs - cfg.clock.offsetNs)
+		}
 
-			// High-precision timing: capture receive timestamp
-			recvTime := time.Now()
-			recvNs := recvTime.UnixNano()
-			e2e := time.Since(sendTime).Milliseconds()
+		batchMutex.Lock()
+		batchResults = append(batchResults, batchResult{
+			workerE2E:          resp.E2ELatencyMs,
+			clientE2E:          e2e,
+			avgCpuFreqKhz:      resp.AvgCpuFreqKhz,
+			cpuFreqOK:          resp.CpuFreqAvailable,
+			iterations:         resp.Iterations,
+			clientSendNs:       sendNs,
+			clientRecvNs:       recvNs,
+			networkLatencyNs:   networkLatencyNs,
+			workerProcessingNs: workerProcessingNs,
+			dataPlaneLatencyNs: dataPlaneLatencyNs,
+			responsePathNs:     responsePathNs,
+		})
+		clientE2EMs = append(clientE2EMs, float64(clientRoundTripNs)/1e6)
+		networkMs = append(networkMs, float64(networkLatencyNs)/1e6)
+		if cfg.profile != nil {
+			perClassE2EMs[durationMs] = append(perClassE2EMs[durationMs], float64(clientRoundTripNs)/1e6)
+		}
+		if cfg.freshConn {
+			coldE2EMs = append(coldE2EMs, float64(connectNs+clientRoundTripNs)/1e6)
+			connectMs = append(connectMs, float64(connectNs)/1e6)
+		}
+		if cfg.timeseriesWindow > 0 {
+			timeSamples = append(timeSamples, timeSample{sendTime.Sub(expStart), float64(clientRoundTripNs) / 1e3})
+		}
+		if attempt > 0 {
+			retriedOKCount++
+			retriedE2EMs = append(retriedE2EMs, float64(recvNs-firstSendNs)/1e6)
+		}
+		perTargetE2EMs[target] = append(perTargetE2EMs[target], float64(clientRoundTripNs)/1e6)
+		if target == 0 {
+			perConnE2EMs[conn] = append(perConnE2EMs[conn], float64(clientRoundTripNs)/1e6)
+		}
+		if intendedNs != 0 {
+			correctedE2EMs = append(correctedE2EMs, float64(recvNs-intendedNs)/1e6)
+		}
+		if cfg.rampTo > 0 {
+			rampSamples = append(rampSamples, rampSample{rps, float64(clientRoundTripNs) / 1e6})
+		}
+		if cfg.targetP99Ms > 0 {
+			aimdWindowMs = append(aimdWindowMs, float64(clientRoundTripNs)/1e6)
+		}
+		perInstance[resp.WorkerInstance]++
+		perNode[resp.NodeName]++
+		sentBytes += int64(proto.Size(req))
+		recvBytes += int64(proto.Size(resp))
+		batchMutex.Unlock()
+	}
 
-			if err != nil {
-				if ctx.Err() == context.DeadlineExceeded {
-					atomic.AddInt64(&timeoutCount, 1)
+	if cfg.closedLoop {
+		// Each connection sends its next request as soon as the previous one returns
+		for conn := range pool.clients {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// The run's rng is not safe for concurrent use; each sender has its own
+				connRng := rand.New(rand.NewSource(cfg.seed + int64(conn) + 1))
+				for time.Now().Before(expEnd) && atomic.LoadInt32(&stopEarly) == 0 && ctx.Err() == nil {
+					idx := atomic.AddInt64(&reqCount, 1)
+					totalRequests.Inc() // Prometheus metric
+					send(0, conn, idx, drawDuration(connRng), 0, 0)
 				}
-				total := atomic.LoadInt64(&reqCount)
-				timeouts := atomic.LoadInt64(&timeoutCount)
-				if total > 50 && float64(timeouts)/float64(total) > 0.10 {
-					atomic.StoreInt32(&stopEarly, 1)
-					expCancel()
+			}()
+		}
+	}
+
+	// intended is when the next request is due: the tick for uniform, the
+	// scheduled arrival for poisson. Poisson arrivals follow the schedule rather
+	// than sleeping from the last send, so oversleeping does not thin them out.
+	intended := expStart
+	tickInterval := time.Second / time.Duration(max(cfg.rps, 1))
+	varyingRate := cfg.rampTo > 0 || cfg.targetP99Ms > 0
+	aimdRPS, aimdWindowStart := float64(cfg.rps), expStart
+	for !cfg.closedLoop && time.Now().Before(expEnd) && atomic.LoadInt32(&stopEarly) == 0 && ctx.Err() == nil {
+		rps := float64(cfg.rps)
+		if cfg.rampTo > 0 {
+			rps = rampRPS(cfg.rps, cfg.rampTo, cfg.rampSteps, float64(time.Since(expStart))/float64(cfg.experiment))
+		}
+		if cfg.targetP99Ms > 0 {
+			if now := time.Now(); now.Sub(aimdWindowStart) >= cfg.aimdWindow {
+				batchMutex.Lock()
+				window := aimdWindowMs
+				aimdWindowMs = nil
+				batchMutex.Unlock()
+				p99 := stats.Percentile(window, 99)
+				aimdTrajectory = append(aimdTrajectory, aimdPoint{now.Sub(expStart).Seconds(), aimdRPS, len(window), p99})
+				if len(window) > 0 {
+					aimdRPS = aimdNext(aimdRPS, p99, cfg.targetP99Ms, cfg.aimdStep, cfg.aimdBackoff)
 				}
-				return
+				aimdWindowStart = now
+			}
+			rps = aimdRPS
+		}
+		if cfg.distribution == "uniform" {
+			if interval := time.Duration(float64(time.Second) / rps); varyingRate && interval != tickInterval {
+				ticker.Reset(interval)
+				tickInterval = interval
 			}
+			intended = <-ticker.C
+		} else {
+			meanInterval := float64(time.Second) / rps
+			intended = intended.Add(time.Duration(rng.ExpFloat64() * meanInterval))
+			time.Sleep(time.Until(intended))
+		}
 
-			// Calculate network-specific metrics
-			clientRoundTripNs := recvNs - sendNs
-			workerProcessingNs := resp.WorkerProcessingNs
-			networkLatencyNs := clientRoundTripNs - workerProcessingNs
-			// Approximate one-way data plane latency (divide by 2 for request + response path)
-			dataPlaneLatencyNs := networkLatencyNs / 2
+		dispatch := time.Now()
+		if !prevDispatch.IsZero() {
+			interval := float64(dispatch.Sub(prevDispatch))
+			sumInterval += interval
+			sumSqInterval += interval * interval
+			intervalCount++
+		}
+		prevDispatch = dispatch
 
-			batchMutex.Lock()
-			batchResults = append(batchResults, batchResult{
-				workerE2E:          resp.E2ELatencyMs,
-				clientE2E:          e2e,
-				avgCpuFreqKhz:      resp.AvgCpuFreqKhz,
-				iterations:         resp.Iterations,
-				clientSendNs:       sendNs,
-				clientRecvNs:       recvNs,
-				networkLatencyNs:   networkLatencyNs,
-				workerProcessingNs: workerProcessingNs,
-				dataPlaneLatencyNs: dataPlaneLatencyNs,
-			})
-			batchMutex.Unlock()
-		}(newReqID)
+		newReqID := atomic.AddInt64(&reqCount, 1)
+		totalRequests.Inc() // Prometheus metric
+
+		target, d := pickTarget(), drawDuration(rng)
+		wg.Add(1)
+		go func(idx int64, intendedNs int64) {
+			defer wg.Done()
+			send(target, targets[target].next(), idx, d, intendedNs, rps)
+		}(newReqID, intended.UnixNano())
 	}
+	expElapsed := time.Since(expStart)
 
 	wg.Wait()
 	close(done)
+	if cfg.closedLoop {
+		// Closed loop: throughput of completed requests, including the last ones in flight
+		expElapsed = time.Since(expStart)
+	}
+
+	if ctx.Err() != nil {
+		logger.Printf("Interrupted %s into the experiment phase; the summary covers the %d requests sent", expElapsed.Round(time.Millisecond), atomic.LoadInt64(&reqCount))
+		fmt.Printf("Interrupted: partial summary of %d requests\n", atomic.LoadInt64(&reqCount))
+	}
 
 	// Log final batch
+	var finalBatch BatchAverages
 	batchMutex.Lock()
 	if len(batchResults) > 0 {
-		var sumWorker, sumClient, sumFreq, sumIter int64
-		var sumNetworkLatency, sumDataPlane, sumWorkerProcessing int64
-		var dataPlaneLatencies []int64
+		finalBatch = averageBatch(batchResults)
+		logBatch(logger, "Final Batch Avg", finalBatch)
+	}
+	batchMutex.Unlock()
+	if pollNodeStats.Load() {
+		logNodeStats(pool.client(), logger)
+	}
 
-		for _, r := range batchResults {
-			sumWorker += r.workerE2E
-			sumClient += r.clientE2E
-			sumFreq += r.avgCpuFreqKhz
-			sumIter += r.iterations
-			sumNetworkLatency += r.networkLatencyNs
-			sumDataPlane += r.dataPlaneLatencyNs
-			sumWorkerProcessing += r.workerProcessingNs
-			dataPlaneLatencies = append(dataPlaneLatencies, r.dataPlaneLatencyNs)
+	total := atomic.LoadInt64(&reqCount)
+	timeouts := atomic.LoadInt64(&timeoutCount)
+	timeoutRate := 0.0
+	if total > 0 {
+		timeoutRate = 100 * float64(timeouts) / float64(total)
+	}
+
+	// Achieved send rate over the experiment phase (excludes warmup and draining)
+	achievedRPS := 0.0
+	if expElapsed > 0 {
+		achievedRPS = float64(total) / expElapsed.Seconds()
+	}
+	if !cfg.closedLoop && !varyingRate && achievedRPS < 0.95*float64(cfg.rps) {
+		logger.Printf("WARNING: achieved RPS %.2f is more than 5%% below target %d; run may be invalid due to generator backpressure", achievedRPS, cfg.rps)
+		fmt.Printf("WARNING: achieved RPS %.2f is more than 5%% below target %d\n", achievedRPS, cfg.rps)
+	}
+
+	// Inter-arrival fidelity: uniform should give CoV ~0, poisson CoV ~1
+	targetIntervalMs := 1000.0 / float64(cfg.rps)
+	if intervalCount > 1 && !varyingRate {
+		meanInterval := sumInterval / float64(intervalCount)
+		variance := sumSqInterval/float64(intervalCount) - meanInterval*meanInterval
+		cov := 0.0
+		if meanInterval > 0 && variance > 0 {
+			cov = math.Sqrt(variance) / meanInterval
+		}
+		meanIntervalMs := meanInterval / 1e6
+		logger.Printf("Inter-arrival: Mean=%.3f ms (target %.3f ms), CoV=%.3f, Dist=%s", meanIntervalMs, targetIntervalMs, cov, cfg.distribution)
+		fmt.Printf("Inter-arrival: Mean=%.3f ms (target %.3f ms), CoV=%.3f\n", meanIntervalMs, targetIntervalMs, cov)
+		if math.Abs(meanIntervalMs-targetIntervalMs) > 0.10*targetIntervalMs {
+			logger.Printf("WARNING: observed mean inter-arrival deviates more than 10%% from target; generator could not keep up")
+			fmt.Printf("WARNING: observed mean inter-arrival deviates more than 10%% from target\n")
 		}
+	}
+
+	// Client E2E percentiles over the whole experiment phase
+	e2eStats := stats.Summary(clientE2EMs)
+	p50, p95, p99 := e2eStats.P50, e2eStats.P95, e2eStats.P99
+	logger.Printf("Client E2E percentiles: P50=%.3f ms, P95=%.3f ms, P99=%.3f ms, CoV=%.3f, IQR=%.3f ms, Mean=%.3f ms, StdDev=%.3f ms, Min=%.3f ms, Max=%.3f ms (%d successful reqs)",
+		p50, p95, p99, e2eStats.CoV, e2eStats.IQR, e2eStats.Mean, e2eStats.StdDev, e2eStats.Min, e2eStats.Max, len(clientE2EMs))
+	fmt.Printf("Client E2E: P50=%.3f ms, P95=%.3f ms, P99=%.3f ms, CoV=%.3f, IQR=%.3f ms\n", p50, p95, p99, e2eStats.CoV, e2eStats.IQR)
+	fmt.Printf("Client E2E: Mean=%.3f ms, StdDev=%.3f ms, Min=%.3f ms, Max=%.3f ms\n", e2eStats.Mean, e2eStats.StdDev, e2eStats.Min, e2eStats.Max)
 
-		n := float64(len(batchResults))
-		avgWorker := float64(sumWorker) / n
-		avgClient := float64(sumClient) / n
-		avgFreq := float64(sumFreq) / n
-		avgIter := float64(sumIter) / n
-		avgNetworkLatencyUs := float64(sumNetworkLatency) / n / 1000.0
-		avgDataPlaneUs := float64(sumDataPlane) / n / 1000.0
-		avgWorkerProcessingMs := float64(sumWorkerProcessing) / n / 1e6
+	// Network latency (round trip minus worker processing), extremes included for tail analysis
+	networkStats := stats.Summary(networkMs)
+	logger.Printf("Network latency: P50=%.3f ms, P95=%.3f ms, P99=%.3f ms, Mean=%.3f ms, StdDev=%.3f ms, Min=%.3f ms, Max=%.3f ms",
+		networkStats.P50, networkStats.P95, networkStats.P99, networkStats.Mean, networkStats.StdDev, networkStats.Min, networkStats.Max)
+	fmt.Printf("Network latency: P50=%.3f ms, P99=%.3f ms, Mean=%.3f ms, StdDev=%.3f ms, Min=%.3f ms, Max=%.3f ms\n",
+		networkStats.P50, networkStats.P99, networkStats.Mean, networkStats.StdDev, networkStats.Min, networkStats.Max)
+
+	var correctedStats stats.Stats
+	if len(correctedE2EMs) > 0 {
+		correctedStats = stats.Summary(correctedE2EMs)
+		p999 := stats.Percentile(correctedE2EMs, 99.9)
+		logger.Printf("Client E2E from intended send time (coordinated-omission corrected): P50=%.3f ms, P95=%.3f ms, P99=%.3f ms, P99.9=%.3f ms", correctedStats.P50, correctedStats.P95, correctedStats.P99, p999)
+		fmt.Printf("Client E2E (corrected): P50=%.3f ms, P95=%.3f ms, P99=%.3f ms, P99.9=%.3f ms\n", correctedStats.P50, correctedStats.P95, correctedStats.P99, p999)
+	}
 
-		// Calculate jitter
-		var sumSqDiff float64
-		meanDataPlane := float64(sumDataPlane) / n
-		for _, val := range dataPlaneLatencies {
-			diff := float64(val) - meanDataPlane
-			sumSqDiff += diff * diff
+	if cfg.histCSV && len(clientE2EMs) > 0 {
+		histFile := fmt.Sprintf("logs/%s_hist.csv", runID)
+		if err := writeHistogramCSV(histFile, clientE2EMs); err != nil {
+			logger.Printf("Failed to write %s: %v", histFile, err)
+			fmt.Printf("WARNING: failed to write %s: %v\n", histFile, err)
 		}
-		jitterUs := 0.0
-		if len(dataPlaneLatencies) > 1 {
-			jitterUs = math.Sqrt(sumSqDiff/float64(len(dataPlaneLatencies))) / 1000.0
+	}
+
+	if cfg.timeseriesWindow > 0 {
+		tsFile := fmt.Sprintf("logs/%s_timeseries.csv", runID)
+		if err := writeTimeSeriesCSV(tsFile, timeSamples, cfg.timeseriesWindow); err != nil {
+			logger.Printf("Failed to write %s: %v", tsFile, err)
+			fmt.Printf("WARNING: failed to write %s: %v\n", tsFile, err)
 		}
+	}
 
-		logger.Printf("Final Batch Avg (last %d reqs): WorkerE2E=%.2f ms, ClientE2E=%.2f ms, NetworkLatency=%.2f µs, DataPlaneLatency=%.2f µs, Jitter=%.2f µs, WorkerProcessing=%.3f ms, AvgCPUFreq=%.2f kHz, AvgIterations=%.0f",
-			len(batchResults), avgWorker, avgClient, avgNetworkLatencyUs, avgDataPlaneUs, jitterUs, avgWorkerProcessingMs, avgFreq, avgIter)
+	if cfg.rampTo > 0 {
+		rampFile := fmt.Sprintf("logs/%s_ramp.csv", runID)
+		if err := writeRampCSV(rampFile, rampSamples); err != nil {
+			logger.Printf("Failed to write %s: %v", rampFile, err)
+			fmt.Printf("WARNING: failed to write %s: %v\n", rampFile, err)
+		} else {
+			fmt.Printf("Ramp: latency by RPS written to %s\n", rampFile)
+		}
 	}
-	batchMutex.Unlock()
 
-	total := atomic.LoadInt64(&reqCount)
-	timeouts := atomic.LoadInt64(&timeoutCount)
-	timeoutRate := 0.0
-	if total > 0 {
-		timeoutRate = 100 * float64(timeouts) / float64(total)
+	// Cold path: what a new flow costs over the reused connections' E2E above
+	var coldStats stats.Stats
+	if cfg.freshConn {
+		coldStats = stats.Summary(coldE2EMs)
+		cs := stats.Summary(connectMs)
+		logger.Printf("Cold path (new connection per request): connect + DoWork P50=%.3f ms, P95=%.3f ms, P99=%.3f ms; connect alone P50=%.3f ms, P95=%.3f ms, P99=%.3f ms",
+			coldStats.P50, coldStats.P95, coldStats.P99, cs.P50, cs.P95, cs.P99)
+		fmt.Printf("Cold path: connect + DoWork P50=%.3f ms, P99=%.3f ms; connect alone P50=%.3f ms, P99=%.3f ms\n", coldStats.P50, coldStats.P99, cs.P50, cs.P99)
+	}
+
+	// Per-destination split, to find VIPs (e.g. late in the iptables chain)
+	// with systematically higher latency
+	if len(targets) > 1 {
+		dests := make([]string, len(targets))
+		for i, t := range targets {
+			dests[i] = t.target
+			ts := stats.Summary(perTargetE2EMs[i])
+			logger.Printf("Destination %d %s: P50=%.3f ms, P95=%.3f ms, P99=%.3f ms (%d successful, %d failed reqs)", i, t.target, ts.P50, ts.P95, ts.P99, ts.Count, perTargetFailed[i])
+		}
+		destFile := fmt.Sprintf("logs/%s_dest.csv", runID)
+		if err := writeDestCSV(destFile, dests, perTargetE2EMs, perTargetFailed); err != nil {
+			logger.Printf("Failed to write %s: %v", destFile, err)
+			fmt.Printf("WARNING: failed to write %s: %v\n", destFile, err)
+		} else {
+			fmt.Printf("Latency by destination written to %s\n", destFile)
+		}
+	}
+
+	if cfg.abBatch > 0 {
+		logABComparison(logger, targets[0].target, targets[1].target, stats.Summary(perTargetE2EMs[0]), stats.Summary(perTargetE2EMs[1]))
+	}
+
+	if cfg.targetP99Ms > 0 {
+		converged := convergedRPS(aimdTrajectory)
+		logger.Printf("AIMD: converged to %.1f RPS for P99 <= %.3f ms over %d windows of %s", converged, cfg.targetP99Ms, len(aimdTrajectory), cfg.aimdWindow)
+		fmt.Printf("AIMD: converged to %.1f RPS for P99 <= %.3f ms\n", converged, cfg.targetP99Ms)
+		aimdFile := fmt.Sprintf("logs/%s_aimd.csv", runID)
+		if err := writeAIMDCSV(aimdFile, aimdTrajectory); err != nil {
+			logger.Printf("Failed to write %s: %v", aimdFile, err)
+			fmt.Printf("WARNING: failed to write %s: %v\n", aimdFile, err)
+		}
+	}
+
+	// Latency of each class of a work profile, to see how the slow requests hold up the fast
+	for _, d := range slices.Sorted(maps.Keys(perClassE2EMs)) {
+		cs := stats.Summary(perClassE2EMs[d])
+		logger.Printf("Work class %d ms: P50=%.3f ms, P95=%.3f ms, P99=%.3f ms (%d successful reqs)", d, cs.P50, cs.P95, cs.P99, cs.Count)
+		fmt.Printf("Work class %d ms: P50=%.3f ms, P95=%.3f ms, P99=%.3f ms (%d reqs)\n", d, cs.P50, cs.P95, cs.P99, cs.Count)
+	}
+
+	// Overhead of the path under test (e.g. kube-proxy) over the direct echo floor
+	if cfg.baseline != nil && len(networkMs) > 0 {
+		ns := networkStats
+		base := cfg.baseline.P50Ms
+		logger.Printf("Network latency over baseline P50 %.3f ms (%s): P50=%+.3f ms, P95=%+.3f ms, P99=%+.3f ms",
+			base, cfg.baseline.Target, ns.P50-base, ns.P95-base, ns.P99-base)
+		fmt.Printf("Overhead over baseline (%.3f ms): P50=%+.3f ms, P95=%+.3f ms, P99=%+.3f ms\n", base, ns.P50-base, ns.P95-base, ns.P99-base)
+	}
+
+	// Per-connection split, to spot a connection slowed by queueing behind its own requests
+	if len(perConnE2EMs) > 1 && len(targets) == 1 {
+		for conn, e2es := range perConnE2EMs {
+			cs := stats.Summary(e2es)
+			logger.Printf("Connection %d: P50=%.3f ms, P99=%.3f ms (%d successful reqs)", conn, cs.P50, cs.P99, cs.Count)
+			fmt.Printf("Connection %d: P50=%.3f ms, P99=%.3f ms (%d reqs)\n", conn, cs.P50, cs.P99, cs.Count)
+		}
+	}
+
+	// Sampling uncertainty of the percentiles, to tell real differences between runs from noise
+	if cfg.bootstrapResamples > 0 && len(clientE2EMs) > 0 {
+		cis := stats.BootstrapPercentileCIs(clientE2EMs, []float64{50, 95, 99}, cfg.bootstrapResamples, cfg.bootstrapSeed)
+		logger.Printf("Client E2E 95%% CIs (bootstrap B=%d, seed %d): P50=%.3f ms [%.3f,%.3f], P95=%.3f ms [%.3f,%.3f], P99=%.3f ms [%.3f,%.3f]",
+			cfg.bootstrapResamples, cfg.bootstrapSeed, p50, cis[0].Lo, cis[0].Hi, p95, cis[1].Lo, cis[1].Hi, p99, cis[2].Lo, cis[2].Hi)
+		fmt.Printf("Client E2E 95%% CIs: P50=%.3f ms [%.3f,%.3f], P95=%.3f ms [%.3f,%.3f], P99=%.3f ms [%.3f,%.3f]\n",
+			p50, cis[0].Lo, cis[0].Hi, p95, cis[1].Lo, cis[1].Hi, p99, cis[2].Lo, cis[2].Hi)
+	}
+
+	// Payload volume: protobuf message sizes only, excluding gRPC/HTTP2 framing, headers and TLS
+	if expElapsed > 0 {
+		mbps := float64(sentBytes+recvBytes) * 8 / expElapsed.Seconds() / 1e6
+		logger.Printf("Bytes on wire (est., protobuf payload only): Sent=%d, Received=%d, Throughput=%.3f Mbps", sentBytes, recvBytes, mbps)
+		fmt.Printf("Bytes on wire (est.): sent %d, received %d, %.3f Mbps\n", sentBytes, recvBytes, mbps)
+	}
+
+	// Failures by status code, to tell a saturated worker (DeadlineExceeded,
+	// ResourceExhausted) from a proxy or connection problem (Unavailable)
+	if len(failures) > 0 {
+		logger.Printf("Failures by status code (%d reqs sent):", total)
+		fmt.Printf("Failures by status code:\n")
+		fmt.Printf("  %-20s %8s %8s\n", "Code", "Count", "Percent")
+		for _, code := range slices.Sorted(maps.Keys(failures)) {
+			pct := 100 * float64(failures[code]) / float64(total)
+			logger.Printf("  %-20s %8d %7.2f%%", code, failures[code], pct)
+			fmt.Printf("  %-20s %8d %7.2f%%\n", code, failures[code], pct)
+		}
+	}
+
+	// First-attempt vs eventual success, so retries do not hide a flaky path
+	retries := atomic.LoadInt64(&retryCount)
+	if cfg.maxRetries > 0 && total > 0 {
+		failed := int64(0)
+		for _, n := range failures {
+			failed += n
+		}
+		firstPct := 100 * float64(total-failed-retriedOKCount) / float64(total)
+		eventualPct := 100 * float64(total-failed) / float64(total)
+		logger.Printf("Retries: %d of %d attempts (budget %.0f%%); success on first attempt %.2f%%, eventually %.2f%% (%d reqs saved by a retry)",
+			retries, atomic.LoadInt64(&attemptCount), 100*cfg.retryBudget, firstPct, eventualPct, retriedOKCount)
+		fmt.Printf("Retries: %d; success first attempt %.2f%%, eventual %.2f%%\n", retries, firstPct, eventualPct)
+		if len(retriedE2EMs) > 0 {
+			rs := stats.Summary(retriedE2EMs)
+			logger.Printf("Retried requests E2E (from first send): P50=%.3f ms, P99=%.3f ms, Max=%.3f ms", rs.P50, rs.P99, rs.Max)
+			fmt.Printf("Retried requests E2E (from first send): P50=%.3f ms, P99=%.3f ms\n", rs.P50, rs.P99)
+		}
+	}
+
+	if cfg.pushgatewayURL != "" {
+		if err := pushRunSummary(cfg.pushgatewayURL, cfg.rps, cfg.durationMs, cfg.distribution, cfg.labels, p50, p95, p99, timeoutRate, achievedRPS); err != nil {
+			logger.Printf("Pushgateway push failed: %v", err)
+			fmt.Printf("WARNING: pushgateway push failed: %v\n", err)
+		}
+	}
+
+	if cfg.influxURL != "" {
+		line := influxRunLine(cfg, len(targets), e2eStats, achievedRPS, timeoutRate, time.Now())
+		if err := writeInflux(cfg.influxURL, cfg.influxBucket, cfg.influxOrg, os.Getenv("INFLUX_TOKEN"), line); err != nil {
+			logger.Printf("InfluxDB write failed: %v", err)
+			fmt.Printf("WARNING: InfluxDB write failed: %v\n", err)
+		}
+	}
+
+	// Which replicas served the run, to check the proxy spreads load across endpoints
+	instances := slices.Sorted(maps.Keys(perInstance))
+	var instanceCounts []int64
+	for _, inst := range instances {
+		if inst == "" {
+			continue // worker predates WorkerInstance
+		}
+		share := 100 * float64(perInstance[inst]) / float64(len(clientE2EMs))
+		logger.Printf("Worker instance %s: %d reqs (%.1f%%)", inst, perInstance[inst], share)
+		fmt.Printf("Worker instance %s: %d reqs (%.1f%%)\n", inst, perInstance[inst], share)
+		instanceCounts = append(instanceCounts, perInstance[inst])
+	}
+	// Fairness of the split; endpoints that served nothing are not seen here
+	if len(instanceCounts) > 1 {
+		chi2 := stats.ChiSquareUniform(instanceCounts)
+		logger.Printf("Load-balancing fairness: Endpoints=%d, ChiSquare=%.3f (df=%d)", len(instanceCounts), chi2, len(instanceCounts)-1)
+		fmt.Printf("Load-balancing fairness: %d endpoints, chi-square=%.3f (df=%d)\n", len(instanceCounts), chi2, len(instanceCounts)-1)
+	}
+
+	// Node-level split, to tell pod-level imbalance from node-level imbalance
+	for _, node := range slices.Sorted(maps.Keys(perNode)) {
+		if node == "" {
+			continue // NODE_NAME not set on the worker
+		}
+		share := 100 * float64(perNode[node]) / float64(len(clientE2EMs))
+		logger.Printf("Worker node %s: %d reqs (%.1f%%)", node, perNode[node], share)
+		fmt.Printf("Worker node %s: %d reqs (%.1f%%)\n", node, perNode[node], share)
 	}
 
 	runDuration := time.Since(runStart)
-	logger.Printf("Finished experiment: RPS=%d, Duration=%dms, Dist=%s, WorkMode=%s, ProxyMode=%s, TotalReq=%d, Timeouts=%d (%.2f%%), RunTime=%s",
-		rps, durationMs, distribution, workMode, proxyMode, total, timeouts, timeoutRate, runDuration)
-	fmt.Printf("Timeout rate: %.2f%%, Total run duration: %s\n", timeoutRate, runDuration)
-}
+	logger.Printf("Finished experiment: RPS=%d, AchievedRPS=%.2f, Connections=%d, Duration=%dms, Dist=%s, WorkMode=%s, ProxyMode=%s, TotalReq=%d, Timeouts=%d (%.2f%%), RunTime=%s",
+		cfg.rps, achievedRPS, len(pool.conns), cfg.durationMs, cfg.distribution, cfg.workMode, cfg.proxyMode, total, timeouts, timeoutRate, runDuration)
+	if cfg.targetP99Ms > 0 {
+		fmt.Printf("Achieved RPS: %.2f (AIMD from %d), Timeout rate: %.2f%%, Total run duration: %s\n", achievedRPS, cfg.rps, timeoutRate, runDuration)
+	} else if cfg.rampTo > 0 {
+		fmt.Printf("Achieved RPS: %.2f (ramp %d->%d), Timeout rate: %.2f%%, Total run duration: %s\n", achievedRPS, cfg.rps, cfg.rampTo, timeoutRate, runDuration)
+	} else if cfg.closedLoop {
+		fmt.Printf("Achieved RPS: %.2f (closed loop, %d connections), Timeout rate: %.2f%%, Total run duration: %s\n", achievedRPS, len(pool.conns), timeoutRate, runDuration)
+	} else {
+		fmt.Printf("Achieved RPS: %.2f (target %d), Timeout rate: %.2f%%, Total run duration: %s\n", achievedRPS, cfg.rps, timeoutRate, runDuration)
+	}
 
-// ---------------- Main Function ----------------
-func main() {
-	fmt.Println("Loadgen Script running")
+	return RunResult{
+		RunID:          runID,
+		TotalRequests:  total,
+		Timeouts:       timeouts,
+		TimeoutRatePct: timeoutRate,
+		AchievedRPS:    achievedRPS,
+		StoppedEarly:   atomic.LoadInt32(&stopEarly) != 0,
+		Interrupted:    ctx.Err() != nil,
+		ClientE2E:      e2eStats,
+		CorrectedE2E:   correctedStats,
+		Network:        networkStats,
+		Retries:        retries,
+		RetriedOK:      retriedOKCount,
+		ColdE2E:        coldStats,
+		FinalBatch:     finalBatch,
+	}
+}
 
-	workerAddr := flag.String("worker", "localhost:50051", "Worker gRPC host:port")
-	workMode := flag.String("work-mode", "full", "Work mode: full or echo")
-	proxyMode := flag.String("proxy-mode", "unknown", "Kube-proxy mode: iptables-nft or nftables")
-	experimentName := flag.String("experiment-name", "", "Custom experiment name for logs")
-	flag.Parse()
+// averageBatch computes the per-request averages of a batch of successful requests.
+func averageBatch(batch []batchResult) BatchAverages {
+	var sumWorker, sumClient, sumFreq, sumIter int64
+	var sumNetworkLatency, sumDataPlane, sumResponsePath, sumWorkerProcessing int64
+	var freqSamples int
+	dataPlaneLatencies := make([]float64, 0, len(batch))
 
-	// Logging
-	f, _ := os.Create("load.log")
-	defer f.Close()
-	log.SetOutput(f)
+	for _, r := range batch {
+		sumWorker += r.workerE2E
+		sumClient += r.clientE2E
+		if r.cpuFreqOK {
+			sumFreq += r.avgCpuFreqKhz
+			freqSamples++
+		}
+		sumIter += r.iterations
+		sumNetworkLatency += r.networkLatencyNs
+		sumDataPlane += r.dataPlaneLatencyNs
+		sumResponsePath += r.responsePathNs
+		sumWorkerProcessing += r.workerProcessingNs
+		dataPlaneLatencies = append(dataPlaneLatencies, float64(r.dataPlaneLatencyNs))
+	}
 
-	// Start Prometheus metrics server
-	prometheus.MustRegister(totalRequests)
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		fmt.Println("Inactive! -- Prometheus metrics")
-		http.ListenAndServe(":9090", nil)
-	}()
+	n := float64(len(batch))
+	avgFreq := 0.0
+	if freqSamples > 0 {
+		avgFreq = float64(sumFreq) / float64(freqSamples)
+	}
+	return BatchAverages{
+		Requests:           len(batch),
+		WorkerE2EMs:        float64(sumWorker) / n,
+		ClientE2EMs:        float64(sumClient) / n,
+		NetworkLatencyUs:   float64(sumNetworkLatency) / n / 1000.0,
+		DataPlaneLatencyUs: float64(sumDataPlane) / n / 1000.0,
+		ResponsePathUs:     float64(sumResponsePath) / n / 1000.0,
+		JitterUs:           stats.StdDev(dataPlaneLatencies) / 1000.0, // standard deviation of data plane latency
+		WorkerProcessingMs: float64(sumWorkerProcessing) / n / 1e6,
+		AvgCPUFreqKhz:      avgFreq,
+		CPUFreqSamples:     freqSamples,
+		AvgIterations:      float64(sumIter) / n,
+	}
+}
 
-	// Connect to gRPC worker
-	fmt.Printf("Connecting to worker at %s...\n", *workerAddr)
-	conn, err := grpc.Dial(*workerAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// logNodeStats logs the conntrack occupancy reported by whichever worker
+// replica answers. It returns false once polling is pointless because the
+// worker does not implement GetNodeStats.
+func logNodeStats(client pb.WorkerServiceClient, logger *log.Logger) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ns, err := client.GetNodeStats(ctx, &pb.NodeStatsRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		logger.Printf("Node stats: worker does not implement GetNodeStats, polling disabled")
+		return false
+	}
 	if err != nil {
-		log.Fatalf("Failed to connect: %v", err)
+		logger.Printf("Node stats: request failed: %v", err)
+		return true
+	}
+	if !ns.ConntrackAvailable {
+		logger.Printf("Node stats (%s): conntrack counters unavailable", ns.WorkerInstance)
+		return true
+	}
+	usage := 0.0
+	if ns.ConntrackMax > 0 {
+		usage = 100 * float64(ns.ConntrackCount) / float64(ns.ConntrackMax)
 	}
-	defer conn.Close()
-	client := pb.NewWorkerServiceClient(conn)
-	fmt.Println("Connection successful")
+	logger.Printf("Node stats (%s): ConntrackCount=%d, ConntrackMax=%d (%.2f%%)", ns.WorkerInstance, ns.ConntrackCount, ns.ConntrackMax, usage)
+	return true
+}
 
-	// Grid search values
-	rpsValues := []int{10, 20, 30} //{15, 20, 25, 30, 35, 40}
-	distributions := []string{"uniform"}
-	durations := []int32{600, 900} //{300, 400, 500, 600, 700, 800, 900, 1000}
+// logBatch writes one batch-average line to the run log.
+func logBatch(logger *log.Logger, label string, a BatchAverages) {
+	avgFreq := "N/A"
+	if a.CPUFreqSamples > 0 {
+		avgFreq = fmt.Sprintf("%.2f kHz", a.AvgCPUFreqKhz)
+	}
+	logger.Printf("%s (last %d reqs): WorkerE2E=%.2f ms, ClientE2E=%.2f ms, NetworkLatency=%.2f µs, DataPlaneLatency=%.2f µs, ResponsePath=%.2f µs, Jitter=%.2f µs, WorkerProcessing=%.3f ms, AvgCPUFreq=%s, AvgIterations=%.0f",
+		label, a.Requests, a.WorkerE2EMs, a.ClientE2EMs, a.NetworkLatencyUs, a.DataPlaneLatencyUs, a.ResponsePathUs, a.JitterUs, a.WorkerProcessingMs, avgFreq, a.AvgIterations)
+}
 
-	fmt.Println("Performing Grid Search")
-	fmt.Printf("Configuration: WorkMode=%s, ProxyMode=%s\n", *workMode, *proxyMode)
-	for _, rps := range rpsValues {
-		for _, dist := range distributions {
-			for _, dur := range durations {
-				RunExperiment(client, rps, dur, dist, *workMode, *proxyMode, *experimentName)
-				time.Sleep(5 * time.Second) // sleep between runs
-			}
+// ---------------- Pushgateway ----------------
+// pushRunSummary pushes a finished run's summary to a Prometheus Pushgateway,
+// grouped by rps/duration/distribution, so short-lived runs reach Grafana.
+func pushRunSummary(url string, rps int, durationMs int32, distribution string, labels runLabels, p50, p95, p99, timeoutRate, achievedRPS float64) error {
+	latency := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "loadgen_run_client_e2e_latency_ms",
+		Help: "Client E2E latency percentiles of the last run in milliseconds",
+	}, []string{"quantile"})
+	latency.WithLabelValues("0.5").Set(p50)
+	latency.WithLabelValues("0.95").Set(p95)
+	latency.WithLabelValues("0.99").Set(p99)
+
+	timeouts := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loadgen_run_timeout_rate_percent",
+		Help: "Percentage of requests of the last run that timed out",
+	})
+	timeouts.Set(timeoutRate)
+
+	achieved := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loadgen_run_achieved_rps",
+		Help: "Achieved send rate of the last run's experiment phase",
+	})
+	achieved.Set(achievedRPS)
+
+	pusher := push.New(url, "loadgen").
+		Grouping("rps", strconv.Itoa(rps)).
+		Grouping("duration_ms", strconv.Itoa(int(durationMs))).
+		Grouping("distribution", distribution)
+	for _, l := range labels {
+		pusher = pusher.Grouping(l.key, l.value)
+	}
+	return pusher.
+		Collector(latency).
+		Collector(timeouts).
+		Collector(achieved).
+		Push()
+}
+
+// ---------------- InfluxDB ----------------
+// influxRunLine formats a finished run as one InfluxDB line protocol point of
+// measurement dataplane, tagged like the run and stamped with its end time.
+// The run's own tags win over a -label of the same key.
+func influxRunLine(cfg runConfig, serviceCount int, e2e stats.Stats, achievedRPS, timeoutRate float64, at time.Time) string {
+	tags := map[string]string{}
+	for _, l := range cfg.labels {
+		tags[l.key] = l.value
+	}
+	tags["proxy_mode"] = cfg.proxyMode
+	tags["service_count"] = strconv.Itoa(serviceCount)
+	tags["rps"] = strconv.Itoa(cfg.rps)
+	tags["duration_ms"] = strconv.Itoa(int(cfg.durationMs))
+	tags["distribution"] = cfg.distribution
+	tags["work_mode"] = cfg.workMode
+
+	var b strings.Builder
+	b.WriteString("dataplane")
+	for _, k := range slices.Sorted(maps.Keys(tags)) { // sorted keys are what InfluxDB indexes fastest
+		if tags[k] == "" {
+			continue // empty tag values are not allowed
 		}
+		fmt.Fprintf(&b, ",%s=%s", influxEscape(k), influxEscape(tags[k]))
+	}
+	fmt.Fprintf(&b, " p50=%g,p95=%g,p99=%g,mean=%g,achieved_rps=%g,timeout_rate_pct=%g,count=%di %d",
+		e2e.P50, e2e.P95, e2e.P99, e2e.Mean, achievedRPS, timeoutRate, e2e.Count, at.UnixNano())
+	return b.String()
+}
+
+// influxEscape escapes a tag key or value for line protocol.
+var influxEscape = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace
+
+// writeInflux writes line protocol to bucket through the InfluxDB v2 write
+// API, with token (if set) as the API token.
+func writeInflux(baseURL, bucket, org, token, lines string) error {
+	q := url.Values{"bucket": {bucket}, "precision": {"ns"}}
+	if org != "" {
+		q.Set("org", org)
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/api/v2/write?"+q.Encode(), strings.NewReader(lines))
+	if err != nil {
+		return err
 	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// ---------------- Clock Sync ----------------
+// syncClock estimates the worker clock offset with n echo pings using the
+// NTP four-timestamp method (client send, worker arrival, worker response,
+// client receive), keeping the ping with the lowest network delay.
+func syncClock(client pb.WorkerServiceClient, n int) (*clockEstimate, error) {
+	var best *clockEstimate
+	for i := range n {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		t0 := time.Now().UnixNano()
+		resp, err := client.DoWork(ctx, &pb.WorkRequest{WorkMode: "echo", Id: fmt.Sprintf("clock-sync-%d", i)})
+		t3 := time.Now().UnixNano()
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("ping %d: %w", i, err)
+		}
+
+		t1, t2 := resp.ArrivalTimestampNs, resp.ResponseTimestampNs
+		est := &clockEstimate{
+			offsetNs: ((t1 - t0) + (t2 - t3)) / 2,
+			rttNs:    (t3 - t0) - (t2 - t1),
+		}
+		if best == nil || est.rttNs < best.rttNs {
+			best = est
+		}
+	}
+	return best, nil
+}
+
+// ---------------- TLS Credentials ----------------
+// clientCredentials builds TLS client credentials. caFile overrides the system
+// roots; certFile/keyFile, if both set, are presented to the worker for mTLS.
+func clientCredentials(certFile, keyFile, caFile string) (credentials.TransportCredentials, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client key pair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// ---------------- Connection Readiness ----------------
+// sourceDialer returns a gRPC context dialer whose TCP connections originate
+// from ip, and logs the local address of every connection it opens.
+func sourceDialer(ip string) (func(context.Context, string) (net.Conn, error), error) {
+	localIP := net.ParseIP(ip)
+	if localIP == nil {
+		return nil, fmt.Errorf("%q is not an IP address", ip)
+	}
+	d := &net.Dialer{LocalAddr: &net.TCPAddr{IP: localIP}}
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Connected %s -> %s", conn.LocalAddr(), conn.RemoteAddr())
+		return conn, nil
+	}, nil
+}
+
+// ---------------- Connection Pool ----------------
+// connPool spreads DoWork calls round-robin over several connections to one
+// target. Over a single connection every request shares one HTTP/2 stream
+// queue, so a slow request can hold up the next (head-of-line blocking) and
+// that wait is measured as data-plane latency; more connections isolate it.
+type connPool struct {
+	target   string
+	dialOpts []grpc.DialOption
+	conns    []*grpc.ClientConn
+	clients  []pb.WorkerServiceClient
+	rr       atomic.Uint64
+}
+
+// dialPool opens n connections to target. Each is a separate ClientConn, and so
+// a separate TCP connection.
+func dialPool(target string, n int, dialOpts []grpc.DialOption) (*connPool, error) {
+	p := &connPool{target: target, dialOpts: dialOpts}
+	for range n {
+		conn, err := grpc.NewClient(target, dialOpts...)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+		p.clients = append(p.clients, pb.NewWorkerServiceClient(conn))
+	}
+	return p, nil
+}
+
+// next returns the index of the next connection in round-robin order.
+func (p *connPool) next() int {
+	return int((p.rr.Add(1) - 1) % uint64(len(p.clients)))
+}
+
+// client returns the next connection's client in round-robin order.
+func (p *connPool) client() pb.WorkerServiceClient {
+	return p.clients[p.next()]
+}
+
+// dialFresh opens a new connection to the pool's target, outside the pool,
+// and waits until it is READY. Its handshake is a new flow through the
+// data plane, which the pool's reused connections only pay once.
+func (p *connPool) dialFresh(timeout time.Duration) (*grpc.ClientConn, error) {
+	conn, err := grpc.NewClient(p.target, p.dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := readiness.WaitForReady(conn, timeout); err != nil {
+		conn.Close()
+		return nil, status.Errorf(codes.Unavailable, "new connection: %v", err)
+	}
+	return conn, nil
+}
+
+// Close closes every connection of the pool.
+func (p *connPool) Close() {
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+}
+
+// readVIPList reads the host:port targets of a -vip-list file, one per line.
+// Blank lines and lines starting with # are skipped.
+func readVIPList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		addrs = append(addrs, line)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%s has no targets", path)
+	}
+	return addrs, nil
+}
+
+// ---------------- Cluster VIPs ----------------
+// kubeconfig is the part of a kubeconfig file needed to list services with
+// a client certificate or bearer token. Exec and auth-provider plugins are
+// not supported.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"` // base64
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"` // base64
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"` // base64
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// defaultKubeconfig is $KUBECONFIG (its first entry) or ~/.kube/config.
+func defaultKubeconfig() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".kube", "config")
+}
+
+// kubeAPIClient returns the API server URL of the kubeconfig's current
+// context, an HTTP client authenticated as its user, and the bearer token
+// if the user has one.
+func kubeAPIClient(path string) (server string, client *http.Client, token string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, "", err
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return "", nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	// Files named in a kubeconfig are relative to it
+	rel := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(filepath.Dir(path), p)
+	}
+	// PEM data is inline (base64) or in a file
+	readEither := func(inline, file string) ([]byte, error) {
+		if inline != "" {
+			return base64.StdEncoding.DecodeString(inline)
+		}
+		if file == "" {
+			return nil, nil
+		}
+		return os.ReadFile(rel(file))
+	}
+
+	var clusterName, userName string
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+		}
+	}
+	if clusterName == "" {
+		return "", nil, "", fmt.Errorf("%s: current context %q not found", path, kc.CurrentContext)
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		server = c.Cluster.Server
+		cfg.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		ca, err := readEither(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority)
+		if err != nil {
+			return "", nil, "", err
+		}
+		if len(ca) > 0 {
+			cfg.RootCAs = x509.NewCertPool()
+			if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+				return "", nil, "", fmt.Errorf("%s: no certificates in the CA of cluster %q", path, clusterName)
+			}
+		}
+	}
+	if server == "" {
+		return "", nil, "", fmt.Errorf("%s: cluster %q has no server", path, clusterName)
+	}
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		cert, err := readEither(u.User.ClientCertificateData, u.User.ClientCertificate)
+		if err != nil {
+			return "", nil, "", err
+		}
+		key, err := readEither(u.User.ClientKeyData, u.User.ClientKey)
+		if err != nil {
+			return "", nil, "", err
+		}
+		if len(cert) > 0 {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return "", nil, "", fmt.Errorf("%s: client certificate of user %q: %w", path, userName, err)
+			}
+			cfg.Certificates = []tls.Certificate{pair}
+		}
+		token = u.User.Token
+		if token == "" && u.User.TokenFile != "" {
+			t, err := os.ReadFile(rel(u.User.TokenFile))
+			if err != nil {
+				return "", nil, "", err
+			}
+			token = strings.TrimSpace(string(t))
+		}
+	}
+	client = &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{TLSClientConfig: cfg}}
+	return strings.TrimSuffix(server, "/"), client, token, nil
+}
+
+// listClusterVIPs lists the services matching selector in all namespaces
+// through the API server of kubeconfig path, and returns the ClusterIP:port
+// of their first port, in the order the API returns them. Headless services
+// have no VIP and are skipped.
+func listClusterVIPs(path, selector string) ([]string, error) {
+	server, client, token, err := kubeAPIClient(path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, server+"/api/v1/services?"+url.Values{"labelSelector": {selector}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("listing services: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var list struct {
+		Items []struct {
+			Spec struct {
+				ClusterIP string `json:"clusterIP"`
+				Ports     []struct {
+					Port int `json:"port"`
+				} `json:"ports"`
+			} `json:"spec"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("listing services: %w", err)
+	}
+	var addrs []string
+	for _, svc := range list.Items {
+		if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == "None" || len(svc.Spec.Ports) == 0 {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(svc.Spec.ClusterIP, strconv.Itoa(svc.Spec.Ports[0].Port)))
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no services with a ClusterIP match %q", selector)
+	}
+	return addrs, nil
+}
+
+// ---------------- Tracing ----------------
+// traceInterceptor wraps every DoWork in a client span carrying the work
+// parameters and the dialed service address; otelgrpc adds the RPC span below it.
+// Other calls (health checks, GetNodeStats) pass through untraced; isDoWork
+// keeps otelgrpc from tracing them too.
+func traceInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if method != pb.WorkerService_DoWork_FullMethodName {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	attrs := []attribute.KeyValue{attribute.String("service.vip", cc.Target())}
+	if wr, ok := req.(*pb.WorkRequest); ok {
+		attrs = append(attrs,
+			attribute.String("work.mode", wr.WorkMode),
+			attribute.Int("work.duration_ms", int(wr.DurationMs)),
+			attribute.String("request.id", wr.Id),
+		)
+	}
+	ctx, span := tracer.Start(ctx, "loadgen.DoWork", trace.WithAttributes(attrs...))
+	defer span.End()
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	return err
+}
+
+// isDoWork limits the otelgrpc client handler to DoWork, so the health and
+// GetNodeStats polls do not flood the trace backend.
+func isDoWork(info *grpcstats.RPCTagInfo) bool {
+	return info.FullMethodName == pb.WorkerService_DoWork_FullMethodName
+}
+
+// ---------------- Histogram CSV ----------------
+// histBucketsPerDecade sets the resolution of -hist-csv: 10 buckets per power
+// of 10, i.e. each bucket about 26% wider than the last.
+const histBucketsPerDecade = 10
+
+// writeHistogramCSV writes a log-spaced histogram of latenciesMs, in µs, for
+// plotting a latency distribution or CDF without the raw samples.
+func writeHistogramCSV(path string, latenciesMs []float64) error {
+	latenciesUs := make([]float64, len(latenciesMs))
+	for i, ms := range latenciesMs {
+		latenciesUs[i] = ms * 1000
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"bucket_us_low", "bucket_us_high", "count"})
+	for _, b := range stats.LogHistogram(latenciesUs, histBucketsPerDecade) {
+		w.Write([]string{strconv.FormatFloat(b.Low, 'f', 3, 64), strconv.FormatFloat(b.High, 'f', 3, 64), strconv.FormatInt(b.Count, 10)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ---------------- A/B ----------------
+// logABComparison reports the client E2E latency through the service VIP
+// against dialing the worker directly; the difference is the proxy's cost.
+func logABComparison(logger *log.Logger, direct, vip string, d, v stats.Stats) {
+	logger.Printf("A/B direct (%s): P50=%.3f ms, P95=%.3f ms, P99=%.3f ms, Mean=%.3f ms (%d reqs)", direct, d.P50, d.P95, d.P99, d.Mean, d.Count)
+	logger.Printf("A/B VIP (%s): P50=%.3f ms, P95=%.3f ms, P99=%.3f ms, Mean=%.3f ms (%d reqs)", vip, v.P50, v.P95, v.P99, v.Mean, v.Count)
+	logger.Printf("A/B VIP - direct: P50=%+.3f ms, P95=%+.3f ms, P99=%+.3f ms, Mean=%+.3f ms", v.P50-d.P50, v.P95-d.P95, v.P99-d.P99, v.Mean-d.Mean)
+	fmt.Printf("A/B direct: P50=%.3f ms, P95=%.3f ms, P99=%.3f ms (%d reqs)\n", d.P50, d.P95, d.P99, d.Count)
+	fmt.Printf("A/B VIP:    P50=%.3f ms, P95=%.3f ms, P99=%.3f ms (%d reqs)\n", v.P50, v.P95, v.P99, v.Count)
+	fmt.Printf("A/B VIP - direct: P50=%+.3f ms, P95=%+.3f ms, P99=%+.3f ms, Mean=%+.3f ms\n", v.P50-d.P50, v.P95-d.P95, v.P99-d.P99, v.Mean-d.Mean)
+}
+
+// ---------------- Baseline ----------------
+// baseline is the network round-trip floor measured by -calibrate: echo
+// requests with no work sent straight to the worker, timed from the client
+// minus the worker's own processing time.
+type baseline struct {
+	Target   string    `json:"target"`
+	Requests int       `json:"requests"`
+	MinMs    float64   `json:"min_ms"`
+	P50Ms    float64   `json:"p50_ms"`
+	Measured time.Time `json:"measured"`
+}
+
+// calibrate sends n sequential no-work echo requests to measure the baseline.
+func calibrate(client pb.WorkerServiceClient, target string, n int) (baseline, error) {
+	rtts := make([]float64, 0, n)
+	for i := range n {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		sendNs := time.Now().UnixNano()
+		resp, err := client.DoWork(ctx, &pb.WorkRequest{WorkMode: "echo", Id: fmt.Sprintf("calibrate-%d", i)})
+		recvNs := time.Now().UnixNano()
+		cancel()
+		if err != nil {
+			return baseline{}, fmt.Errorf("request %d: %w", i, err)
+		}
+		rtts = append(rtts, float64(recvNs-sendNs-resp.WorkerProcessingNs)/1e6)
+	}
+	st := stats.Summary(rtts)
+	return baseline{Target: target, Requests: n, MinMs: st.Min, P50Ms: st.P50, Measured: time.Now()}, nil
+}
+
+func writeBaseline(path string, b baseline) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func readBaseline(path string) (*baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &b, nil
+}
+
+// ---------------- Error Rate ----------------
+// errorWindow is the failure rate over the last n completed requests.
+type errorWindow struct {
+	failed       []bool // ring of the last n outcomes
+	next, filled int
+	failures     int
+}
+
+func newErrorWindow(n int) *errorWindow {
+	return &errorWindow{failed: make([]bool, max(n, 1))}
+}
+
+// add records one outcome and returns the failure rate over the window and
+// whether the window has seen n requests yet.
+func (w *errorWindow) add(failed bool) (rate float64, full bool) {
+	if w.filled == len(w.failed) {
+		if w.failed[w.next] {
+			w.failures--
+		}
+	} else {
+		w.filled++
+	}
+	w.failed[w.next] = failed
+	if failed {
+		w.failures++
+	}
+	w.next = (w.next + 1) % len(w.failed)
+	return float64(w.failures) / float64(w.filled), w.filled == len(w.failed)
+}
+
+// ---------------- Retries ----------------
+// retryable reports whether a failed DoWork may be sent again: it is
+// idempotent, so only transient failures like a conntrack drop during a
+// kube-proxy resync or a lost deadline are worth retrying.
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// withinRetryBudget reports whether retries out of attempts stay within
+// budget, the largest allowed fraction of retries.
+func withinRetryBudget(retries, attempts int64, budget float64) bool {
+	return float64(retries) <= budget*float64(attempts)
+}
+
+// retryBaseBackoff is the backoff cap before the first retry; it doubles with
+// every further attempt.
+const retryBaseBackoff = 10 * time.Millisecond
+
+// retryBackoff is the wait before retry number attempt+1: full jitter over
+// an exponentially growing cap, so retries of a burst of failures spread out.
+func retryBackoff(attempt int) time.Duration {
+	return time.Duration(rand.Int63n(int64(retryBaseBackoff << min(attempt, 10))))
+}
+
+// ---------------- Work Profile ----------------
+// workProfile is a weighted mix of request durations from -work-profile, e.g.
+// 0ms:70,50ms:20,500ms:10 for 70% no-work, 20% 50 ms and 10% 500 ms requests.
+type workProfile []workClass
+
+type workClass struct {
+	durationMs int32
+	weight     int
+}
+
+func parseWorkProfile(s string) (workProfile, error) {
+	var p workProfile
+	for _, entry := range strings.Split(s, ",") {
+		dur, weight, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("want duration:weight, got %q", entry)
+		}
+		d, err := time.ParseDuration(dur)
+		if err != nil || d < 0 || d%time.Millisecond != 0 {
+			return nil, fmt.Errorf("duration %q must be a whole number of milliseconds, e.g. 50ms", dur)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 1 {
+			return nil, fmt.Errorf("weight %q must be a positive integer", weight)
+		}
+		p = append(p, workClass{int32(d.Milliseconds()), w})
+	}
+	return p, nil
+}
+
+// sample draws a duration with probability proportional to its weight.
+func (p workProfile) sample(rng *rand.Rand) int32 {
+	total := 0
+	for _, c := range p {
+		total += c.weight
+	}
+	n := rng.Intn(total)
+	for _, c := range p {
+		if n < c.weight {
+			return c.durationMs
+		}
+		n -= c.weight
+	}
+	return p[len(p)-1].durationMs
+}
+
+// String is the profile in run-ID form, e.g. 0ms70-50ms20-500ms10.
+func (p workProfile) String() string {
+	parts := make([]string, len(p))
+	for i, c := range p {
+		parts[i] = fmt.Sprintf("%dms%d", c.durationMs, c.weight)
+	}
+	return strings.Join(parts, "-")
+}
+
+// ---------------- Time Series ----------------
+// timeSample is one successful request of a run for the time series.
+type timeSample struct {
+	sent      time.Duration // since the start of the experiment phase
+	latencyUs float64
+}
+
+// writeTimeSeriesCSV writes the client E2E latency percentiles of the requests
+// sent in each window of the experiment phase, to spot drift (e.g. conntrack
+// table growth) and transients that the run's overall percentiles hide.
+// Windows without a successful request are written with a count of 0.
+func writeTimeSeriesCSV(path string, samples []timeSample, window time.Duration) error {
+	var byWindow [][]float64
+	for _, s := range samples {
+		i := int(max(s.sent, 0) / window)
+		for len(byWindow) <= i {
+			byWindow = append(byWindow, nil)
+		}
+		byWindow[i] = append(byWindow[i], s.latencyUs)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"window_start_s", "count", "p50_us", "p95_us", "p99_us"})
+	for i, latencies := range byWindow {
+		st := stats.Summary(latencies)
+		w.Write([]string{strconv.FormatFloat(float64(i)*window.Seconds(), 'f', 3, 64), strconv.Itoa(st.Count),
+			strconv.FormatFloat(st.P50, 'f', 1, 64), strconv.FormatFloat(st.P95, 'f', 1, 64), strconv.FormatFloat(st.P99, 'f', 1, 64)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ---------------- Destinations ----------------
+// writeDestCSV writes the client E2E latency and failures of each destination
+// a run sent to; position is its order in -vip-list (or 0 direct, 1 VIP in
+// A/B mode), to line latency up against the rule position of its service.
+func writeDestCSV(path string, dests []string, latenciesMs [][]float64, failed []int64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"dest", "position", "count", "failed", "p50_ms", "p95_ms", "p99_ms", "mean_ms"})
+	for i, dest := range dests {
+		st := stats.Summary(latenciesMs[i])
+		w.Write([]string{dest, strconv.Itoa(i), strconv.Itoa(st.Count), strconv.FormatInt(failed[i], 10),
+			strconv.FormatFloat(st.P50, 'f', 3, 64), strconv.FormatFloat(st.P95, 'f', 3, 64), strconv.FormatFloat(st.P99, 'f', 3, 64),
+			strconv.FormatFloat(st.Mean, 'f', 3, 64)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ---------------- Ramp ----------------
+// rampRPS is the rate of a ramp from start to end RPS at frac (0-1) of the
+// way through it: linear when steps is 0, else the level of the current of
+// steps equal steps, the first at start and the last at end.
+func rampRPS(start, end, steps int, frac float64) float64 {
+	frac = max(0, min(frac, 1))
+	if steps == 0 {
+		return float64(start) + float64(end-start)*frac
+	}
+	if steps == 1 {
+		return float64(start)
+	}
+	step := min(int(frac*float64(steps)), steps-1)
+	return float64(start) + float64(end-start)*float64(step)/float64(steps-1)
+}
+
+// rampSample is one successful request of a ramp and the rate it was sent at.
+type rampSample struct {
+	rps       float64
+	latencyMs float64
+}
+
+// writeRampCSV writes the client E2E latency of a ramp's requests grouped by
+// the rate they were sent at, rounded to whole RPS, to find where the tail
+// latency takes off.
+func writeRampCSV(path string, samples []rampSample) error {
+	byRPS := map[int][]float64{}
+	for _, s := range samples {
+		rps := int(math.Round(s.rps))
+		byRPS[rps] = append(byRPS[rps], s.latencyMs)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"rps", "count", "p50_ms", "p95_ms", "p99_ms"})
+	for _, rps := range slices.Sorted(maps.Keys(byRPS)) {
+		st := stats.Summary(byRPS[rps])
+		w.Write([]string{strconv.Itoa(rps), strconv.Itoa(st.Count),
+			strconv.FormatFloat(st.P50, 'f', 3, 64), strconv.FormatFloat(st.P95, 'f', 3, 64), strconv.FormatFloat(st.P99, 'f', 3, 64)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ---------------- AIMD ----------------
+// aimdPoint is one window of an AIMD run: the rate sent at, and the requests
+// completed in it with their P99 (+Inf if any of the slowest 1% failed).
+type aimdPoint struct {
+	endS  float64 // window end, seconds into the experiment phase
+	rps   float64
+	count int
+	p99Ms float64
+}
+
+// aimdNext is the rate after a window with the given P99: step RPS more while
+// under targetMs, multiplied by backoff once over it, and never below 1 RPS.
+func aimdNext(rps, p99Ms, targetMs, step, backoff float64) float64 {
+	if p99Ms <= targetMs {
+		return rps + step
+	}
+	return max(rps*backoff, 1)
+}
+
+// convergedRPS is the mean rate over the second half of an AIMD trajectory,
+// once the controller has left its start value behind and is cycling around
+// the highest rate that meets the target.
+func convergedRPS(trajectory []aimdPoint) float64 {
+	half := trajectory[len(trajectory)/2:]
+	if len(half) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, pt := range half {
+		sum += pt.rps
+	}
+	return sum / float64(len(half))
+}
+
+// writeAIMDCSV writes the rate and P99 of every window of an AIMD run.
+func writeAIMDCSV(path string, trajectory []aimdPoint) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"window_end_s", "rps", "count", "p99_ms"})
+	for _, pt := range trajectory {
+		w.Write([]string{strconv.FormatFloat(pt.endS, 'f', 3, 64), strconv.FormatFloat(pt.rps, 'f', 2, 64),
+			strconv.Itoa(pt.count), strconv.FormatFloat(pt.p99Ms, 'f', 3, 64)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ---------------- JSON Summary ----------------
+// runSummary is one run's record in the -summary-json file, for analysis in
+// Python or a notebook without parsing the run logs.
+type runSummary struct {
+	RunID          string            `json:"run_id"`
+	Start          time.Time         `json:"start"`
+	End            time.Time         `json:"end"`
+	Mode           string            `json:"mode"`
+	RPS            int               `json:"rps"`
+	DurationMs     int32             `json:"duration_ms"`
+	WorkProfile    string            `json:"work_profile,omitempty"` // replaces duration_ms when set
+	Distribution   string            `json:"distribution"`
+	WorkMode       string            `json:"work_mode"`
+	ProxyMode      string            `json:"proxy_mode"`
+	Connections    int               `json:"connections"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	TotalRequests  int64             `json:"total_requests"`
+	Timeouts       int64             `json:"timeouts"`
+	TimeoutRatePct float64           `json:"timeout_rate_pct"`
+	AchievedRPS    float64           `json:"achieved_rps"`
+	StoppedEarly   bool              `json:"stopped_early"`
+	Interrupted    bool              `json:"interrupted"`
+	ClientE2E      latencySummary    `json:"client_e2e_ms"`
+	CorrectedE2E   *latencySummary   `json:"corrected_e2e_ms,omitempty"` // open loop only
+	Network        latencySummary    `json:"network_ms"`
+	Retries        int64             `json:"retries"`
+	RetriedOK      int64             `json:"retried_ok"`
+	ColdE2E        *latencySummary   `json:"cold_e2e_ms,omitempty"` // -fresh-conn only
+}
+
+// latencySummary is the JSON form of a latency stats.Stats, in ms.
+type latencySummary struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	P50    float64 `json:"p50"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+}
+
+func newLatencySummary(s stats.Stats) latencySummary {
+	return latencySummary{Count: s.Count, Mean: s.Mean, StdDev: s.StdDev, Min: s.Min, Max: s.Max, P50: s.P50, P95: s.P95, P99: s.P99}
+}
+
+// newRunSummary builds the JSON record of a run that went from start to end.
+func newRunSummary(cfg runConfig, connections int, start, end time.Time, r RunResult) runSummary {
+	rs := runSummary{
+		RunID:          r.RunID,
+		Start:          start,
+		End:            end,
+		Mode:           "open",
+		RPS:            cfg.rps,
+		DurationMs:     cfg.durationMs,
+		Distribution:   cfg.distribution,
+		WorkMode:       cfg.workMode,
+		ProxyMode:      cfg.proxyMode,
+		Connections:    connections,
+		TotalRequests:  r.TotalRequests,
+		Timeouts:       r.Timeouts,
+		TimeoutRatePct: r.TimeoutRatePct,
+		AchievedRPS:    r.AchievedRPS,
+		StoppedEarly:   r.StoppedEarly,
+		Interrupted:    r.Interrupted,
+		ClientE2E:      newLatencySummary(r.ClientE2E),
+		Network:        newLatencySummary(r.Network),
+		Retries:        r.Retries,
+		RetriedOK:      r.RetriedOK,
+	}
+	if cfg.profile != nil {
+		rs.WorkProfile = cfg.profile.String()
+	}
+	if cfg.freshConn {
+		cold := newLatencySummary(r.ColdE2E)
+		rs.ColdE2E = &cold
+	}
+	if cfg.closedLoop {
+		rs.Mode = "closed"
+	} else {
+		corrected := newLatencySummary(r.CorrectedE2E)
+		rs.CorrectedE2E = &corrected
+	}
+	if len(cfg.labels) > 0 {
+		rs.Labels = map[string]string{}
+		for _, l := range cfg.labels {
+			rs.Labels[l.key] = l.value
+		}
+	}
+	return rs
+}
+
+// writeSummaries writes the runs so far as a JSON array, replacing path, so an
+// aborted sweep still leaves the runs it finished.
+func writeSummaries(path string, runs []runSummary) error {
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// ---------------- Sweep ----------------
+// sweep calls run for every point of the grid, RPS outermost. Once a
+// distribution/duration pair stops early or times out more than maxTimeoutPct
+// percent of its requests, its higher-RPS points are skipped, since they will
+// only be worse. maxTimeoutPct 0 disables skipping. An interrupted run ends the
+// sweep.
+func sweep(rpsValues []int, distributions []string, durations []int32, maxTimeoutPct float64, run func(rps int, dist string, dur int32) RunResult) {
+	type sweepKey struct {
+		dist string
+		dur  int32
+	}
+	saturated := map[sweepKey]bool{}
+	for _, rps := range rpsValues {
+		for _, dist := range distributions {
+			for _, dur := range durations {
+				key := sweepKey{dist, dur}
+				if saturated[key] {
+					fmt.Printf("Skipping RPS=%d, DUR=%d, Dist=%s: lower RPS already exceeded the timeout limit\n", rps, dur, dist)
+					continue
+				}
+				result := run(rps, dist, dur)
+				if result.Interrupted {
+					fmt.Println("Sweep interrupted, skipping the remaining runs")
+					return
+				}
+				if maxTimeoutPct > 0 && (result.StoppedEarly || result.TimeoutRatePct > maxTimeoutPct) {
+					saturated[key] = true
+				}
+			}
+		}
+	}
+}
+
+// ---------------- Sweep Config ----------------
+// sweepConfig is the experiment plan of a sweep, read from a -sweep-config
+// YAML file. Fields the file leaves out keep their defaultSweepConfig value.
+type sweepConfig struct {
+	RPS           []int         `yaml:"rps"`
+	Distributions []string      `yaml:"distributions"`
+	DurationsMs   []int32       `yaml:"durations_ms"`
+	Warmup        time.Duration `yaml:"warmup"`     // per run, results discarded
+	Experiment    time.Duration `yaml:"experiment"` // per run, measured
+	Pause         time.Duration `yaml:"pause"`      // between runs
+}
+
+// defaultSweepConfig is the plan used without -sweep-config.
+func defaultSweepConfig() sweepConfig {
+	return sweepConfig{
+		RPS:           []int{10, 20, 30}, //{15, 20, 25, 30, 35, 40}
+		Distributions: []string{"uniform"},
+		DurationsMs:   []int32{600, 900}, //{300, 400, 500, 600, 700, 800, 900, 1000}
+		Warmup:        WARMUPMIN * time.Minute,
+		Experiment:    EXPMIN * time.Minute,
+		Pause:         5 * time.Second,
+	}
+}
+
+// loadSweepConfig reads and validates a -sweep-config file.
+func loadSweepConfig(path string) (sweepConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return sweepConfig{}, err
+	}
+	defer f.Close()
+	cfg := defaultSweepConfig()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return sweepConfig{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return sweepConfig{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (c sweepConfig) validate() error {
+	if len(c.RPS) == 0 || len(c.Distributions) == 0 || len(c.DurationsMs) == 0 {
+		return fmt.Errorf("rps, distributions and durations_ms must not be empty")
+	}
+	// sweep skips the higher RPS of a saturated point, which assumes RPS only grows
+	for i, rps := range c.RPS {
+		if rps < 1 {
+			return fmt.Errorf("rps must be at least 1, got %d", rps)
+		}
+		if i > 0 && rps <= c.RPS[i-1] {
+			return fmt.Errorf("rps must be strictly increasing, got %d after %d", rps, c.RPS[i-1])
+		}
+	}
+	for _, dist := range c.Distributions {
+		if dist != "uniform" && dist != "poisson" {
+			return fmt.Errorf("distribution must be uniform or poisson, got %q", dist)
+		}
+	}
+	for _, dur := range c.DurationsMs {
+		if dur < 1 {
+			return fmt.Errorf("durations_ms must be positive, got %d", dur)
+		}
+	}
+	if c.Warmup < 0 || c.Experiment <= 0 || c.Pause < 0 {
+		return fmt.Errorf("warmup and pause must not be negative and experiment must be positive")
+	}
+	return nil
+}
+
+// ---------------- Main Function ----------------
+func main() {
+	fmt.Println("Loadgen Script running")
+
+	workerAddr := flag.String("worker", "localhost:50051", "Worker gRPC host:port, or unix:///path/to.sock for a worker started with -listen unix://...")
+	workMode := flag.String("work-mode", "full", "Work mode: full, echo or sleep")
+	proxyMode := flag.String("proxy-mode", "unknown", "Kube-proxy mode: iptables-nft or nftables")
+	experimentName := flag.String("experiment-name", "", "Custom experiment name for logs")
+	targetUtilPct := flag.Int("target-util-pct", 0, "If 1-99, full-mode workers alternate spin and sleep to average this CPU utilization")
+	requestPadBytes := flag.Int("request-pad-bytes", 0, "Padding bytes added to every request payload")
+	responsePadBytes := flag.Int("response-pad-bytes", 0, "Padding bytes the worker adds to every response payload")
+	useTLS := flag.Bool("tls", false, "Connect to the worker over TLS")
+	certFile := flag.String("cert", "", "Client certificate file for mTLS")
+	keyFile := flag.String("key", "", "Client private key file for mTLS")
+	caFile := flag.String("ca", "", "CA bundle for verifying the worker certificate (default: system roots)")
+	// Keepalive keeps idle connections warm between bursts. 0 disables it (gRPC default).
+	// Must not be shorter than the worker's -keepalive-min-time (default 10s) or the
+	// worker answers with GOAWAY; 30s is a sensible value for bursty experiments.
+	keepaliveTime := flag.Duration("keepalive-time", 0, "Send keepalive pings after this much idle time (0 = disabled, min 10s)")
+	keepaliveTimeout := flag.Duration("keepalive-timeout", 20*time.Second, "Wait this long for a keepalive ack before closing the connection")
+	keepalivePermitWithoutStream := flag.Bool("keepalive-permit-without-stream", true, "Send keepalive pings even with no active RPCs")
+	pprofAddr := flag.String("pprof-addr", "", "Serve net/http/pprof on this address, e.g. :6061 (disabled if empty)")
+	// Fail-fast (default) counts a request as failed the moment no subchannel is
+	// READY, e.g. during an endpoint update. Wait-for-ready instead queues it until
+	// a connection is up or its deadline passes: fewer errors, but the wait is
+	// included in that request's latency.
+	waitForReadyCalls := flag.Bool("wait-for-ready", false, "Make DoWork calls wait for a READY connection (within their deadline) instead of failing fast")
+	sourceIP := flag.String("source-ip", "", "Local IP to originate worker connections from, selecting the NIC on multi-homed hosts (kernel default if empty)")
+	var labels runLabels
+	flag.Var(&labels, "label", "Run metadata as key=value, added to run IDs, run logs and pushgateway groups (repeatable)")
+	seed := flag.Int64("seed", 0, "Seed for poisson inter-arrival times, reused by every run of the sweep (0 = time-based)")
+	bootstrapResamples := flag.Int("bootstrap", 0, "Bootstrap resamples for 95% confidence intervals of P50/P95/P99 (0 disables; cost grows with requests per run)")
+	bootstrapSeed := flag.Uint64("bootstrap-seed", 1, "Seed for bootstrap resampling, for reproducible intervals")
+	sweepConfigPath := flag.String("sweep-config", "", "YAML file with the sweep's RPS, distributions, durations and phase lengths (see loadgen/sweep.example.yaml; built-in grid if empty)")
+	sweepMaxTimeoutPct := flag.Float64("sweep-max-timeout-pct", 0, "Skip higher RPS for a duration/distribution once a run exceeds this timeout rate in percent or stops early (0 disables)")
+	histCSV := flag.Bool("hist-csv", false, "Also write a log-spaced histogram of each run's client E2E latency to logs/<runID>_hist.csv")
+	summaryJSON := flag.Bool("summary-json", false, "Also write every run's summary, percentiles and config to logs/[<experiment-name>_]summary_<time>.json")
+	influxURL := flag.String("influx-url", "", "InfluxDB v2 URL to write each run's summary point (measurement dataplane) to, with the API token from $INFLUX_TOKEN (disabled if empty)")
+	influxBucket := flag.String("influx-bucket", "", "InfluxDB bucket for -influx-url")
+	influxOrg := flag.String("influx-org", "", "InfluxDB organization for -influx-url, if the token does not imply one")
+	pushgatewayURL := flag.String("pushgateway", "", "Prometheus Pushgateway URL to push each run's summary to (disabled if empty)")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/gRPC collector host:port for trace export (disabled if empty)")
+	clockSyncPings := flag.Int("clock-sync-pings", 0, "If > 0, estimate worker clock offset with this many echo pings and measure one-way latencies instead of halving")
+	waitHealthyTimeout := flag.Duration("wait-healthy-timeout", 0, "If > 0, poll the worker's gRPC health service until SERVING before starting")
+	// One connection multiplexes every in-flight request over a single HTTP/2
+	// connection, so queueing behind other requests (head-of-line blocking) shows
+	// up as data-plane latency. More connections keep that out of the measurement.
+	connections := flag.Int("connections", 1, "Number of gRPC connections to the worker; requests are spread over them round-robin")
+	maxRetries := flag.Int("max-retries", 0, "Retry a request that fails with Unavailable or DeadlineExceeded up to this many times, with jittered backoff (0 disables)")
+	retryBudget := flag.Float64("retry-budget", 0.1, "Most retries may make up of all attempts in a run (0-1), so retries cannot multiply the load on a failing worker")
+	warmupRequests := flag.Int("warmup-requests", 0, "If > 0, warm up with this many discarded requests instead of for the sweep's warmup duration")
+	maxErrorRate := flag.Float64("max-error-rate", 0.1, "Stop a run early once more than this fraction (0-1) of the last -error-window requests failed (0 disables)")
+	errorWindowFlag := flag.Int("error-window", 50, "Number of recent requests -max-error-rate is measured over, and the fewest a run sends before stopping early")
+	freshConn := flag.Bool("fresh-conn", false, "Send every experiment request on a new connection (connect, DoWork, close) and report the connect + DoWork cold path separately")
+	timeseriesWindow := flag.Duration("timeseries-window", 0, "If > 0, also write client E2E percentiles per window of this length (e.g. 1s) to logs/<runID>_timeseries.csv")
+	workProfileFlag := flag.String("work-profile", "", "Weighted mix of request durations replacing the duration grid, e.g. 0ms:70,50ms:20,500ms:10 (drawn per request)")
+	calibrateRun := flag.Bool("calibrate", false, "Measure the RTT floor with no-work echo requests sent directly to -worker, write it to -baseline (default baseline.json) and exit")
+	calibrateRequests := flag.Int("calibrate-requests", 1000, "Number of echo requests sent by -calibrate")
+	baselinePath := flag.String("baseline", "", "Baseline file from -calibrate; runs then report their network latency over it as the proxy overhead")
+	ramp := flag.Bool("ramp", false, "Instead of the RPS grid, ramp each run's rate from -rps-start to -rps-end over its experiment phase and write latency by RPS to logs/<runID>_ramp.csv")
+	rpsStart := flag.Int("rps-start", 10, "Starting rate of a -ramp or -target-p99-ms run")
+	rpsEnd := flag.Int("rps-end", 100, "Final rate of a -ramp")
+	rampSteps := flag.Int("ramp-steps", 0, "Ramp in this many equal RPS steps instead of linearly (0 = linear)")
+	targetP99Ms := flag.Float64("target-p99-ms", 0, "If > 0, instead of the RPS grid, adapt each run's rate (AIMD, from -rps-start) to the highest that keeps client P99 under this; writes logs/<runID>_aimd.csv")
+	aimdWindow := flag.Duration("aimd-window", 5*time.Second, "AIMD: measure P99 and adjust the rate once per window")
+	aimdStep := flag.Float64("aimd-step", 5, "AIMD: RPS added after a window under the target")
+	aimdBackoff := flag.Float64("aimd-backoff", 0.5, "AIMD: factor the rate is multiplied by after a window over the target")
+	ab := flag.Bool("ab", false, "A/B mode: alternate batches between -worker-direct and -worker-vip in every run and report the VIP's extra latency")
+	workerDirect := flag.String("worker-direct", "", "A/B mode: worker pod address, bypassing kube-proxy")
+	workerVIP := flag.String("worker-vip", "", "A/B mode: worker service VIP address")
+	abBatch := flag.Duration("ab-batch", 10*time.Second, "A/B mode: send to each target for this long before switching")
+	fromCluster := flag.Bool("from-cluster", false, "Like -vip-list, but list the service VIPs matching -service-selector from the cluster of -kubeconfig")
+	kubeconfigPath := flag.String("kubeconfig", defaultKubeconfig(), "Kubeconfig for -from-cluster")
+	serviceSelector := flag.String("service-selector", "type=dummy", "Label selector of the services -from-cluster targets")
+	vipList := flag.String("vip-list", "", "File of service VIP host:port lines, one per line; each open-loop request goes to a random one instead of -worker")
+	mode := flag.String("mode", "open", "Load mode: open (target RPS, sweeping the RPS grid) or closed (one request in flight per -connections, no rate limit)")
+	flag.Parse()
+
+	if *mode != "open" && *mode != "closed" {
+		log.Fatalf("-mode must be open or closed, got %q", *mode)
+	}
+	if *ramp && (*mode == "closed" || *rpsStart < 1 || *rpsEnd < 1 || *rampSteps < 0) {
+		log.Fatalf("-ramp needs -mode open, -rps-start and -rps-end of at least 1 and -ramp-steps of at least 0")
+	}
+	if *targetP99Ms > 0 && (*mode == "closed" || *ramp || *rpsStart < 1 || *aimdWindow <= 0 || *aimdStep <= 0 || *aimdBackoff <= 0 || *aimdBackoff >= 1) {
+		log.Fatalf("-target-p99-ms needs -mode open, no -ramp, -rps-start of at least 1, a positive -aimd-window and -aimd-step, and -aimd-backoff between 0 and 1")
+	}
+	if *ab && (*mode == "closed" || *vipList != "" || *fromCluster || *workerDirect == "" || *workerVIP == "" || *abBatch <= 0) {
+		log.Fatalf("-ab needs -mode open, no -vip-list, both -worker-direct and -worker-vip, and a positive -ab-batch")
+	}
+	if *warmupRequests < 0 {
+		log.Fatalf("-warmup-requests must be >= 0")
+	}
+	if *maxErrorRate < 0 || *maxErrorRate > 1 || *errorWindowFlag < 1 {
+		log.Fatalf("-max-error-rate must be between 0 and 1 and -error-window at least 1")
+	}
+	if *influxURL != "" && *influxBucket == "" {
+		log.Fatalf("-influx-url needs -influx-bucket")
+	}
+	if *timeseriesWindow < 0 {
+		log.Fatalf("-timeseries-window must be >= 0")
+	}
+	if *maxRetries < 0 || *retryBudget < 0 || *retryBudget > 1 {
+		log.Fatalf("-max-retries must be >= 0 and -retry-budget between 0 and 1")
+	}
+	var profile workProfile
+	if *workProfileFlag != "" {
+		var err error
+		if profile, err = parseWorkProfile(*workProfileFlag); err != nil {
+			log.Fatalf("Invalid -work-profile: %v", err)
+		}
+	}
+	if *vipList != "" && *fromCluster {
+		log.Fatalf("Use -vip-list or -from-cluster, not both")
+	}
+	if *calibrateRun && (*vipList != "" || *fromCluster) {
+		log.Fatalf("-calibrate measures the worker directly; use -worker, not -vip-list or -from-cluster")
+	}
+	if (*vipList != "" || *fromCluster) && *mode == "closed" {
+		log.Fatalf("-vip-list and -from-cluster need -mode open")
+	}
+	if *connections < 1 {
+		log.Fatalf("-connections must be at least 1, got %d", *connections)
+	}
+	// Padding at or above gRPC's default 4 MiB message limit fails every RPC with ResourceExhausted
+	for name, size := range map[string]int{"request-pad-bytes": *requestPadBytes, "response-pad-bytes": *responsePadBytes} {
+		if size < 0 || size > maxPadBytes {
+			log.Fatalf("-%s must be between 0 and %d, got %d", name, maxPadBytes, size)
+		}
+	}
+
+	// Ctrl+C (or SIGTERM) ends the current run early with a partial summary and
+	// stops the sweep; a second Ctrl+C kills the process as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	plan := defaultSweepConfig()
+	if *sweepConfigPath != "" {
+		var err error
+		if plan, err = loadSweepConfig(*sweepConfigPath); err != nil {
+			log.Fatalf("Invalid -sweep-config: %v", err)
+		}
+	}
+
+	// Logging
+	f, _ := os.Create("load.log")
+	defer f.Close()
+	log.SetOutput(f)
+
+	// Start Prometheus metrics server
+	prometheus.MustRegister(totalRequests, clientE2ELatency, clientE2ELatencyNative, timeoutsTotal, retriesTotal)
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		fmt.Println("Inactive! -- Prometheus metrics")
+		if err := http.ListenAndServe(":9090", mux); err != nil {
+			log.Printf("Metrics server stopped: %v", err)
+			fmt.Printf("WARNING: metrics server on :9090 stopped: %v\n", err)
+		}
+	}()
+
+	if *pprofAddr != "" {
+		profiling.Start(*pprofAddr, "")
+	}
+
+	// Connect to gRPC worker
+	addrs := []string{*workerAddr}
+	if *vipList != "" {
+		var err error
+		addrs, err = readVIPList(*vipList)
+		if err != nil {
+			log.Fatalf("Invalid -vip-list: %v", err)
+		}
+		fmt.Printf("Connecting to %d service VIPs from %s...\n", len(addrs), *vipList)
+	} else if *fromCluster {
+		var err error
+		addrs, err = listClusterVIPs(*kubeconfigPath, *serviceSelector)
+		if err != nil {
+			log.Fatalf("Failed to list services for -from-cluster: %v", err)
+		}
+		fmt.Printf("Connecting to %d service VIPs matching %s...\n", len(addrs), *serviceSelector)
+	} else if *ab {
+		addrs = []string{*workerDirect, *workerVIP}
+		fmt.Printf("Connecting to worker directly at %s and through the VIP at %s...\n", *workerDirect, *workerVIP)
+	} else {
+		fmt.Printf("Connecting to worker at %s...\n", *workerAddr)
+	}
+	creds := insecure.NewCredentials()
+	if *useTLS {
+		tlsCreds, err := clientCredentials(*certFile, *keyFile, *caFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS credentials: %v", err)
+		}
+		creds = tlsCreds
+	}
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if *keepaliveTime > 0 {
+		dialOpts = append(dialOpts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                *keepaliveTime,
+			Timeout:             *keepaliveTimeout,
+			PermitWithoutStream: *keepalivePermitWithoutStream,
+		}))
+	}
+	if *waitForReadyCalls {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.WaitForReady(true)))
+		fmt.Println("DoWork calls wait for a ready connection instead of failing fast")
+	}
+	if *sourceIP != "" {
+		if strings.HasPrefix(*workerAddr, "unix:") {
+			log.Fatalf("-source-ip does not apply to unix socket targets")
+		}
+		dialer, err := sourceDialer(*sourceIP)
+		if err != nil {
+			log.Fatalf("Invalid -source-ip: %v", err)
+		}
+		dialOpts = append(dialOpts, grpc.WithContextDialer(dialer))
+		fmt.Printf("Binding connections to source IP %s\n", *sourceIP)
+	}
+	if *otlpEndpoint != "" {
+		shutdownTracing, err := tracing.Init(context.Background(), *otlpEndpoint, "loadgen")
+		if err != nil {
+			log.Fatalf("Failed to init tracing: %v", err)
+		}
+		defer shutdownTracing(context.Background())
+		dialOpts = append(dialOpts,
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler(otelgrpc.WithFilter(isDoWork))),
+			grpc.WithUnaryInterceptor(traceInterceptor),
+		)
+		fmt.Printf("Tracing enabled, exporting to %s\n", *otlpEndpoint)
+	}
+	var targets []*connPool
+	for _, addr := range addrs {
+		pool, err := dialPool(addr, *connections, dialOpts)
+		if err != nil {
+			log.Fatalf("Failed to connect to %s: %v", addr, err)
+		}
+		defer pool.Close()
+		for _, conn := range pool.conns {
+			if err := readiness.WaitForReady(conn, 30*time.Second); err != nil {
+				log.Fatalf("Worker not reachable at %s: %v", addr, err)
+			}
+		}
+		targets = append(targets, pool)
+	}
+	if *waitHealthyTimeout > 0 {
+		fmt.Printf("Waiting up to %s for worker to report SERVING...\n", *waitHealthyTimeout)
+		if err := readiness.WaitForHealthy(targets[0].conns[0], *waitHealthyTimeout); err != nil {
+			log.Fatalf("Worker not healthy: %v", err)
+		}
+	}
+	client := targets[0].clients[0]
+	fmt.Printf("Connection successful (%d connections)\n", len(targets)*(*connections))
+
+	var clock *clockEstimate
+	if *clockSyncPings > 0 {
+		var err error
+		clock, err = syncClock(client, *clockSyncPings)
+		if err != nil {
+			log.Fatalf("Clock sync failed: %v", err)
+		}
+		fmt.Printf("Clock sync: offset=%.1f µs, best RTT=%.1f µs over %d pings\n",
+			float64(clock.offsetNs)/1e3, float64(clock.rttNs)/1e3, *clockSyncPings)
+		// An offset larger than the RTT means the clocks disagree by more than the
+		// quantity being measured; the naive /2 split would have been meaningless.
+		if clock.offsetNs > clock.rttNs || -clock.offsetNs > clock.rttNs {
+			fmt.Printf("WARNING: clock offset exceeds ping RTT; client/worker clocks are not in sync (check NTP/PTP)\n")
+		}
+	}
+
+	if *calibrateRun {
+		if *calibrateRequests < 1 {
+			log.Fatalf("-calibrate-requests must be at least 1, got %d", *calibrateRequests)
+		}
+		b, err := calibrate(client, targets[0].target, *calibrateRequests)
+		if err != nil {
+			log.Fatalf("Calibration failed: %v", err)
+		}
+		path := *baselinePath
+		if path == "" {
+			path = "baseline.json"
+		}
+		if err := writeBaseline(path, b); err != nil {
+			log.Fatalf("Failed to write baseline: %v", err)
+		}
+		fmt.Printf("Baseline RTT to %s over %d requests: Min=%.3f ms, P50=%.3f ms, written to %s\n", b.Target, b.Requests, b.MinMs, b.P50Ms, path)
+		return
+	}
+	var base *baseline
+	if *baselinePath != "" {
+		var err error
+		if base, err = readBaseline(*baselinePath); err != nil {
+			log.Fatalf("Invalid -baseline: %v", err)
+		}
+		fmt.Printf("Baseline: P50=%.3f ms to %s, measured %s\n", base.P50Ms, base.Target, base.Measured.Format(time.RFC3339))
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	fmt.Printf("Arrival seed: %d\n", *seed)
+
+	// Grid search values
+	rpsValues, distributions, durations := plan.RPS, plan.Distributions, plan.DurationsMs
+	if *mode == "closed" {
+		// No arrival process to vary: one run per duration at -connections concurrency
+		rpsValues, distributions = []int{0}, []string{"closed"}
+	}
+	if *ramp || *targetP99Ms > 0 {
+		// Each run covers the whole RPS range itself
+		rpsValues = []int{*rpsStart}
+	}
+	if profile != nil {
+		// Durations are drawn per request; durationMs 0 stands for the profile
+		durations = []int32{0}
+	}
+
+	fmt.Println("Performing Grid Search")
+	fmt.Printf("Configuration: WorkMode=%s, ProxyMode=%s\n", *workMode, *proxyMode)
+	baseCfg := runConfig{
+		closedLoop:         *mode == "closed",
+		warmup:             plan.Warmup,
+		warmupRequests:     *warmupRequests,
+		experiment:         plan.Experiment,
+		workMode:           *workMode,
+		proxyMode:          *proxyMode,
+		experimentName:     *experimentName,
+		requestPadBytes:    *requestPadBytes,
+		responsePadBytes:   *responsePadBytes,
+		targetUtilPct:      *targetUtilPct,
+		clock:              clock,
+		pushgatewayURL:     *pushgatewayURL,
+		influxURL:          *influxURL,
+		influxBucket:       *influxBucket,
+		influxOrg:          *influxOrg,
+		bootstrapResamples: *bootstrapResamples,
+		bootstrapSeed:      *bootstrapSeed,
+		seed:               *seed,
+		labels:             labels,
+		histCSV:            *histCSV,
+		baseline:           base,
+		profile:            profile,
+		maxRetries:         *maxRetries,
+		retryBudget:        *retryBudget,
+		timeseriesWindow:   *timeseriesWindow,
+		freshConn:          *freshConn,
+		maxErrorRate:       *maxErrorRate,
+		errorWindow:        *errorWindowFlag,
+	}
+	if *ramp {
+		baseCfg.rampTo, baseCfg.rampSteps = *rpsEnd, *rampSteps
+	}
+	if *ab {
+		baseCfg.abBatch = *abBatch
+	}
+	if *targetP99Ms > 0 {
+		baseCfg.targetP99Ms, baseCfg.aimdWindow, baseCfg.aimdStep, baseCfg.aimdBackoff = *targetP99Ms, *aimdWindow, *aimdStep, *aimdBackoff
+	}
+	summaryPath := fmt.Sprintf("logs/summary_%s.json", time.Now().Format("20060102-150405"))
+	if *experimentName != "" {
+		summaryPath = fmt.Sprintf("logs/%s_summary_%s.json", *experimentName, time.Now().Format("20060102-150405"))
+	}
+	var summaries []runSummary
+	sweep(rpsValues, distributions, durations, *sweepMaxTimeoutPct, func(rps int, dist string, dur int32) RunResult {
+		cfg := baseCfg
+		cfg.rps, cfg.durationMs, cfg.distribution = rps, dur, dist
+		start := time.Now()
+		result := RunExperiment(ctx, targets, cfg)
+		if *summaryJSON {
+			summaries = append(summaries, newRunSummary(cfg, *connections, start, time.Now(), result))
+			if err := writeSummaries(summaryPath, summaries); err != nil {
+				log.Printf("Failed to write %s: %v", summaryPath, err)
+				fmt.Printf("WARNING: failed to write %s: %v\n", summaryPath, err)
+			}
+		}
+		if !result.Interrupted {
+			time.Sleep(plan.Pause) // sleep between runs
+		}
+		return result
+	})
 }
@@ -0,0 +1,738 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"fyp-onboarding/internal/stats"
+	pb "fyp-onboarding/workerpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestAverageBatch(t *testing.T) {
+	batch := []batchResult{
+		{workerE2E: 10, clientE2E: 12, avgCpuFreqKhz: 2000000, cpuFreqOK: true, iterations: 100,
+			networkLatencyNs: 2000, workerProcessingNs: 10e6, dataPlaneLatencyNs: 1000, responsePathNs: 1000},
+		{workerE2E: 20, clientE2E: 24, avgCpuFreqKhz: 3000000, cpuFreqOK: true, iterations: 200,
+			networkLatencyNs: 4000, workerProcessingNs: 20e6, dataPlaneLatencyNs: 3000, responsePathNs: 1000},
+		// cpufreq unreadable on this worker: its 0 kHz must not drag the average down
+		{workerE2E: 30, clientE2E: 36, iterations: 300,
+			networkLatencyNs: 6000, workerProcessingNs: 30e6, dataPlaneLatencyNs: 5000, responsePathNs: 1000},
+	}
+	got := averageBatch(batch)
+	want := BatchAverages{
+		Requests:           3,
+		WorkerE2EMs:        20,
+		ClientE2EMs:        24,
+		NetworkLatencyUs:   4,
+		DataPlaneLatencyUs: 3,
+		ResponsePathUs:     1,
+		// population std dev of 1, 3 and 5 µs
+		JitterUs:           math.Sqrt(8.0 / 3),
+		WorkerProcessingMs: 20,
+		AvgCPUFreqKhz:      2500000,
+		CPUFreqSamples:     2,
+		AvgIterations:      200,
+	}
+	if math.Abs(got.JitterUs-want.JitterUs) > 1e-9 {
+		t.Errorf("JitterUs = %v, want %v", got.JitterUs, want.JitterUs)
+	}
+	got.JitterUs = want.JitterUs
+	if got != want {
+		t.Errorf("averageBatch =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestAverageBatchNoCPUFreq(t *testing.T) {
+	got := averageBatch([]batchResult{{workerE2E: 5, dataPlaneLatencyNs: 7000}})
+	if got.CPUFreqSamples != 0 || got.AvgCPUFreqKhz != 0 {
+		t.Errorf("CPU freq = %v over %d samples, want 0 over 0", got.AvgCPUFreqKhz, got.CPUFreqSamples)
+	}
+	if got.JitterUs != 0 {
+		t.Errorf("JitterUs of a single request = %v, want 0", got.JitterUs)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	type point struct {
+		rps  int
+		dist string
+		dur  int32
+	}
+	tests := []struct {
+		name          string
+		maxTimeoutPct float64
+		results       map[point]RunResult // unlisted points succeed
+		want          []point
+	}{
+		{
+			name:          "disabled",
+			maxTimeoutPct: 0,
+			results:       map[point]RunResult{{10, "uniform", 600}: {TimeoutRatePct: 90}},
+			want: []point{
+				{10, "uniform", 600}, {10, "uniform", 900},
+				{20, "uniform", 600}, {20, "uniform", 900},
+				{30, "uniform", 600}, {30, "uniform", 900},
+			},
+		},
+		{
+			name:          "skips higher rps of the saturated pair only",
+			maxTimeoutPct: 5,
+			results:       map[point]RunResult{{20, "uniform", 600}: {TimeoutRatePct: 6}},
+			want: []point{
+				{10, "uniform", 600}, {10, "uniform", 900},
+				{20, "uniform", 600}, {20, "uniform", 900},
+				{30, "uniform", 900},
+			},
+		},
+		{
+			name:          "at the limit is not saturated",
+			maxTimeoutPct: 5,
+			results:       map[point]RunResult{{10, "uniform", 900}: {TimeoutRatePct: 5}},
+			want: []point{
+				{10, "uniform", 600}, {10, "uniform", 900},
+				{20, "uniform", 600}, {20, "uniform", 900},
+				{30, "uniform", 600}, {30, "uniform", 900},
+			},
+		},
+		{
+			name:          "stopped early",
+			maxTimeoutPct: 50,
+			results:       map[point]RunResult{{10, "uniform", 900}: {StoppedEarly: true, TimeoutRatePct: 11}},
+			want: []point{
+				{10, "uniform", 600}, {10, "uniform", 900},
+				{20, "uniform", 600},
+				{30, "uniform", 600},
+			},
+		},
+		{
+			name:    "interrupted",
+			results: map[point]RunResult{{20, "uniform", 600}: {Interrupted: true}},
+			want: []point{
+				{10, "uniform", 600}, {10, "uniform", 900},
+				{20, "uniform", 600},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []point
+			sweep([]int{10, 20, 30}, []string{"uniform"}, []int32{600, 900}, tt.maxTimeoutPct, func(rps int, dist string, dur int32) RunResult {
+				p := point{rps, dist, dur}
+				got = append(got, p)
+				return tt.results[p]
+			})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ran %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// echoClient answers DoWork with a worker whose clock runs offsetNs ahead of
+// ours, taking processingNs between arrival and response.
+type echoClient struct {
+	pb.WorkerServiceClient
+	offsetNs, processingNs int64
+}
+
+func (c *echoClient) DoWork(ctx context.Context, req *pb.WorkRequest, opts ...grpc.CallOption) (*pb.WorkResponse, error) {
+	arrival := time.Now().UnixNano() + c.offsetNs
+	return &pb.WorkResponse{ArrivalTimestampNs: arrival, ResponseTimestampNs: arrival + c.processingNs}, nil
+}
+
+func TestSyncClockOffset(t *testing.T) {
+	const offsetNs = 5e9
+	est, err := syncClock(&echoClient{offsetNs: offsetNs, processingNs: 1000}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake answers in-process, so the network delay (and so the error) is tiny
+	if d := est.offsetNs - offsetNs; d < -1e6 || d > 1e6 {
+		t.Errorf("offsetNs = %d, want %d ± 1ms", est.offsetNs, int64(offsetNs))
+	}
+	if est.rttNs < -1e6 || est.rttNs > 1e6 {
+		t.Errorf("rttNs = %d, want about 0", est.rttNs)
+	}
+}
+
+func TestRunLabelsSet(t *testing.T) {
+	tests := []struct {
+		in      string
+		wantErr bool
+	}{
+		{"kernel=6.8", false},
+		{"node_type=c5", false},
+		{"novalue", true},
+		{"empty=", true},
+		{"1bad=x", true},
+		{"path=a/b", true},
+		{"rps=10", true},
+		{"duration_ms=600", true},
+		{"distribution=uniform", true},
+		{"job=other", true},
+	}
+	for _, tt := range tests {
+		var l runLabels
+		if err := l.Set(tt.in); (err != nil) != tt.wantErr {
+			t.Errorf("Set(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConnPoolRoundRobin(t *testing.T) {
+	a, b, c := &echoClient{offsetNs: 1}, &echoClient{offsetNs: 2}, &echoClient{offsetNs: 3}
+	p := &connPool{clients: []pb.WorkerServiceClient{a, b, c}}
+	var got []pb.WorkerServiceClient
+	for range 7 {
+		got = append(got, p.client())
+	}
+	want := []pb.WorkerServiceClient{a, b, c, a, b, c, a}
+	if !slices.Equal(got, want) {
+		t.Errorf("client() order = %v, want %v", got, want)
+	}
+}
+
+func TestConnPoolDialFreshUnreachable(t *testing.T) {
+	p := &connPool{target: "127.0.0.1:1", dialOpts: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}}
+	conn, err := p.dialFresh(200 * time.Millisecond)
+	if err == nil {
+		conn.Close()
+		t.Fatal("dialFresh to a closed port succeeded")
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("dialFresh error code = %v, want Unavailable (retryable): %v", status.Code(err), err)
+	}
+}
+
+func TestListClusterVIPs(t *testing.T) {
+	var gotSelector, gotAuth string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/services" {
+			http.NotFound(w, r)
+			return
+		}
+		gotSelector, gotAuth = r.URL.Query().Get("labelSelector"), r.Header.Get("Authorization")
+		w.Write([]byte(`{"items": [
+			{"spec": {"clusterIP": "10.96.0.10", "ports": [{"port": 80}, {"port": 443}]}},
+			{"spec": {"clusterIP": "None", "ports": [{"port": 80}]}},
+			{"spec": {"clusterIP": "10.96.0.12", "ports": []}},
+			{"spec": {"clusterIP": "fd00::c", "ports": [{"port": 8080}]}}
+		]}`))
+	}))
+	defer srv.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kubeconfig := filepath.Join(dir, "config")
+	content := "apiVersion: v1\nkind: Config\ncurrent-context: lab\n" +
+		"contexts:\n- name: other\n  context: {cluster: other, user: other}\n- name: lab\n  context: {cluster: lab, user: admin}\n" +
+		"clusters:\n- name: lab\n  cluster:\n    server: " + srv.URL + "/\n    certificate-authority-data: " + base64.StdEncoding.EncodeToString(ca) + "\n" +
+		"users:\n- name: admin\n  user:\n    tokenFile: token\n"
+	if err := os.WriteFile(kubeconfig, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := listClusterVIPs(kubeconfig, "type=dummy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.96.0.10:80", "[fd00::c]:8080"}; !slices.Equal(got, want) {
+		t.Errorf("listClusterVIPs = %v, want %v", got, want)
+	}
+	if gotSelector != "type=dummy" || gotAuth != "Bearer s3cret" {
+		t.Errorf("request selector %q, auth %q", gotSelector, gotAuth)
+	}
+
+	if err := os.WriteFile(kubeconfig, []byte("current-context: missing\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listClusterVIPs(kubeconfig, "type=dummy"); err == nil {
+		t.Error("listClusterVIPs succeeded without the current context")
+	}
+}
+
+func TestDefaultKubeconfig(t *testing.T) {
+	t.Setenv("KUBECONFIG", "/tmp/a"+string(filepath.ListSeparator)+"/tmp/b")
+	if got := defaultKubeconfig(); got != "/tmp/a" {
+		t.Errorf("defaultKubeconfig = %q, want the first $KUBECONFIG entry", got)
+	}
+}
+
+func TestReadVIPList(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{"targets", "10.96.0.10:80\n10.96.0.11:8080\n", []string{"10.96.0.10:80", "10.96.0.11:8080"}, false},
+		{"comments and blanks", "# dummy services\n\n 10.96.0.10:80 \n", []string{"10.96.0.10:80"}, false},
+		{"missing port", "10.96.0.10\n", nil, true},
+		{"empty", "# nothing\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vips.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readVIPList(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readVIPList error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("readVIPList = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteSummaries(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	open := runConfig{rps: 20, durationMs: 600, distribution: "uniform", workMode: "full", labels: runLabels{{"kernel", "6.8"}}}
+	closed := runConfig{durationMs: 900, distribution: "closed", closedLoop: true}
+	runs := []runSummary{
+		newRunSummary(open, 2, start, start.Add(3*time.Minute), RunResult{RunID: "a", AchievedRPS: 19.9, ClientE2E: stats.Stats{Count: 10, P99: 612.5}, Network: stats.Stats{Min: 0.2, Max: 3.5}}),
+		newRunSummary(closed, 4, start, start.Add(3*time.Minute), RunResult{RunID: "b"}),
+	}
+	path := filepath.Join(t.TempDir(), "summary.json")
+	if err := writeSummaries(path, runs); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("summary is not a JSON array: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d runs, want 2", len(got))
+	}
+	if got[0]["mode"] != "open" || got[0]["rps"] != 20.0 || got[0]["connections"] != 2.0 || got[0]["achieved_rps"] != 19.9 {
+		t.Errorf("open run = %v", got[0])
+	}
+	if e2e := got[0]["client_e2e_ms"].(map[string]any); e2e["p99"] != 612.5 || e2e["count"] != 10.0 {
+		t.Errorf("open run client_e2e_ms = %v", e2e)
+	}
+	if network := got[0]["network_ms"].(map[string]any); network["min"] != 0.2 || network["max"] != 3.5 {
+		t.Errorf("open run network_ms = %v", network)
+	}
+	if labels := got[0]["labels"].(map[string]any); labels["kernel"] != "6.8" {
+		t.Errorf("open run labels = %v", labels)
+	}
+	if _, ok := got[0]["corrected_e2e_ms"]; !ok {
+		t.Errorf("open run has no corrected_e2e_ms")
+	}
+	if got[1]["mode"] != "closed" {
+		t.Errorf("closed run mode = %v", got[1]["mode"])
+	}
+	if _, ok := got[1]["corrected_e2e_ms"]; ok {
+		t.Errorf("closed run has corrected_e2e_ms")
+	}
+	if _, ok := got[0]["cold_e2e_ms"]; ok {
+		t.Errorf("run without -fresh-conn has cold_e2e_ms")
+	}
+}
+
+func TestLoadSweepConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    sweepConfig
+		wantErr bool
+	}{
+		{"empty keeps defaults", "", defaultSweepConfig(), false},
+		{
+			name:    "partial",
+			content: "rps: [50, 100]\ndistributions: [poisson]\nexperiment: 30s\n",
+			want: sweepConfig{
+				RPS:           []int{50, 100},
+				Distributions: []string{"poisson"},
+				DurationsMs:   defaultSweepConfig().DurationsMs,
+				Warmup:        time.Minute,
+				Experiment:    30 * time.Second,
+				Pause:         5 * time.Second,
+			},
+		},
+		{name: "rps not increasing", content: "rps: [20, 20]\n", wantErr: true},
+		{name: "zero rps", content: "rps: [0, 10]\n", wantErr: true},
+		{name: "unknown distribution", content: "distributions: [bursty]\n", wantErr: true},
+		{name: "zero duration", content: "durations_ms: [0]\n", wantErr: true},
+		{name: "zero experiment", content: "experiment: 0s\n", wantErr: true},
+		{name: "empty list", content: "durations_ms: []\n", wantErr: true},
+		{name: "unknown field", content: "service_counts: [100]\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sweep.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadSweepConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadSweepConfig error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadSweepConfig = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSweepExampleConfig(t *testing.T) {
+	got, err := loadSweepConfig("sweep.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, defaultSweepConfig()) {
+		t.Errorf("sweep.example.yaml = %+v, want the defaults %+v", got, defaultSweepConfig())
+	}
+}
+
+func TestWriteHistogramCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hist.csv")
+	if err := writeHistogramCSV(path, []float64{0.5, 0.6, 1.2, 612.5}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rows[0], []string{"bucket_us_low", "bucket_us_high", "count"}) {
+		t.Errorf("header = %v", rows[0])
+	}
+	// 500 µs lands in [398.107, 501.187), 600 µs in [501.187, 630.957)
+	if !slices.Equal(rows[1], []string{"398.107", "501.187", "1"}) || !slices.Equal(rows[2], []string{"501.187", "630.957", "1"}) {
+		t.Errorf("first buckets = %v, %v", rows[1], rows[2])
+	}
+	var total int
+	for _, row := range rows[1:] {
+		n, err := strconv.Atoi(row[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += n
+	}
+	if total != 4 {
+		t.Errorf("histogram holds %d requests, want 4", total)
+	}
+}
+
+func TestErrorWindow(t *testing.T) {
+	w := newErrorWindow(4)
+	steps := []struct {
+		failed   bool
+		wantRate float64
+		wantFull bool
+	}{
+		{true, 1, false},
+		{false, 0.5, false},
+		{false, 1.0 / 3, false},
+		{true, 0.5, true},
+		{false, 0.25, true}, // the first failure drops out
+		{false, 0.25, true},
+		{false, 0.25, true},
+		{false, 0, true}, // and the second
+	}
+	for i, st := range steps {
+		rate, full := w.add(st.failed)
+		if math.Abs(rate-st.wantRate) > 1e-12 || full != st.wantFull {
+			t.Errorf("step %d: add(%v) = %v, %v; want %v, %v", i, st.failed, rate, full, st.wantRate, st.wantFull)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{status.Error(codes.Unavailable, "conntrack drop"), true},
+		{status.Error(codes.DeadlineExceeded, "slow"), true},
+		{status.Error(codes.ResourceExhausted, "full"), false},
+		{status.Error(codes.InvalidArgument, "bad"), false},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithinRetryBudget(t *testing.T) {
+	tests := []struct {
+		retries, attempts int64
+		budget            float64
+		want              bool
+	}{
+		{1, 10, 0.1, true},
+		{2, 10, 0.1, false},
+		{1, 1, 0.1, false},
+		{10, 100, 0.1, true},
+		{1, 100, 0, false},
+		{50, 100, 1, true},
+	}
+	for _, tt := range tests {
+		if got := withinRetryBudget(tt.retries, tt.attempts, tt.budget); got != tt.want {
+			t.Errorf("withinRetryBudget(%d, %d, %v) = %v, want %v", tt.retries, tt.attempts, tt.budget, got, tt.want)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for attempt := range 20 {
+		limit := retryBaseBackoff << min(attempt, 10)
+		for range 100 {
+			if d := retryBackoff(attempt); d < 0 || d >= limit {
+				t.Fatalf("retryBackoff(%d) = %v, want within [0, %v)", attempt, d, limit)
+			}
+		}
+	}
+}
+
+func TestParseWorkProfile(t *testing.T) {
+	p, err := parseWorkProfile("0ms:70, 50ms:20,0.5s:10")
+	if err != nil {
+		t.Fatalf("parseWorkProfile: %v", err)
+	}
+	want := workProfile{{0, 70}, {50, 20}, {500, 10}}
+	if !slices.Equal(p, want) {
+		t.Errorf("parseWorkProfile = %v, want %v", p, want)
+	}
+	if s := p.String(); s != "0ms70-50ms20-500ms10" {
+		t.Errorf("String = %q", s)
+	}
+	for _, bad := range []string{"", "50ms", "50:1", "-5ms:1", "1500us:1", "50ms:0", "50ms:x"} {
+		if _, err := parseWorkProfile(bad); err == nil {
+			t.Errorf("parseWorkProfile(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestWorkProfileSample(t *testing.T) {
+	p := workProfile{{0, 70}, {50, 20}, {500, 10}}
+	rng := rand.New(rand.NewSource(1))
+	counts := map[int32]int{}
+	const n = 100000
+	for range n {
+		counts[p.sample(rng)]++
+	}
+	for _, c := range p {
+		if got, want := float64(counts[c.durationMs])/n, float64(c.weight)/100; math.Abs(got-want) > 0.01 {
+			t.Errorf("%d ms drawn %.3f of the time, want %.2f", c.durationMs, got, want)
+		}
+	}
+	if len(counts) != len(p) {
+		t.Errorf("drew durations %v outside the profile", counts)
+	}
+}
+
+func TestRampRPS(t *testing.T) {
+	tests := []struct {
+		start, end, steps int
+		frac              float64
+		want              float64
+	}{
+		{10, 110, 0, 0, 10},
+		{10, 110, 0, 0.5, 60},
+		{10, 110, 0, 1, 110},
+		{10, 110, 0, 1.5, 110}, // past the end of the phase
+		{100, 10, 0, 0.5, 55},  // ramping down
+		{10, 40, 4, 0, 10},
+		{10, 40, 4, 0.24, 10},
+		{10, 40, 4, 0.25, 20},
+		{10, 40, 4, 0.99, 40},
+		{10, 40, 4, 1, 40},
+		{10, 40, 1, 0.9, 10},
+	}
+	for _, tt := range tests {
+		if got := rampRPS(tt.start, tt.end, tt.steps, tt.frac); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("rampRPS(%d, %d, %d, %v) = %v, want %v", tt.start, tt.end, tt.steps, tt.frac, got, tt.want)
+		}
+	}
+}
+
+func TestWriteRampCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ramp.csv")
+	samples := []rampSample{{20.2, 3}, {10, 1}, {19.8, 5}, {10.4, 2}, {20, 4}}
+	if err := writeRampCSV(path, samples); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "rps,count,p50_ms,p95_ms,p99_ms\n" +
+		"10,2,1.000,2.000,2.000\n" +
+		"20,3,4.000,5.000,5.000\n"
+	if string(data) != want {
+		t.Errorf("ramp CSV =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestInfluxRunLine(t *testing.T) {
+	cfg := runConfig{rps: 200, durationMs: 20, distribution: "poisson", workMode: "full", proxyMode: "iptables",
+		labels: runLabels{{"kernel", "6.8 lts"}, {"rps", "ignored"}}}
+	e2e := stats.Stats{Count: 1200, P50: 1.5, P95: 2.25, P99: 3, Mean: 1.75}
+	got := influxRunLine(cfg, 3, e2e, 199.5, 0.25, time.Unix(1, 5))
+	want := `dataplane,distribution=poisson,duration_ms=20,kernel=6.8\ lts,proxy_mode=iptables,rps=200,service_count=3,work_mode=full ` +
+		"p50=1.5,p95=2.25,p99=3,mean=1.75,achieved_rps=199.5,timeout_rate_pct=0.25,count=1200i 1000000005"
+	if got != want {
+		t.Errorf("influxRunLine =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteInflux(t *testing.T) {
+	var gotPath, gotQuery, gotAuth, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotQuery, gotAuth, gotBody = r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization"), string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	if err := writeInflux(srv.URL+"/", "lab", "", "secret", "dataplane p50=1 1"); err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/api/v2/write" || gotQuery != "bucket=lab&precision=ns" || gotAuth != "Token secret" || gotBody != "dataplane p50=1 1" {
+		t.Errorf("request = %s?%s auth %q body %q", gotPath, gotQuery, gotAuth, gotBody)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bucket not found", http.StatusNotFound)
+	}))
+	defer failing.Close()
+	if err := writeInflux(failing.URL, "missing", "", "", "dataplane p50=1 1"); err == nil {
+		t.Error("writeInflux succeeded on a 404")
+	}
+}
+
+func TestWriteTimeSeriesCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timeseries.csv")
+	samples := []timeSample{
+		{100 * time.Millisecond, 300}, {900 * time.Millisecond, 100}, {500 * time.Millisecond, 200},
+		{2500 * time.Millisecond, 400},
+	}
+	if err := writeTimeSeriesCSV(path, samples, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "window_start_s,count,p50_us,p95_us,p99_us\n" +
+		"0.000,3,200.0,300.0,300.0\n" +
+		"1.000,0,0.0,0.0,0.0\n" +
+		"2.000,1,400.0,400.0,400.0\n"
+	if string(data) != want {
+		t.Errorf("time series CSV =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestWriteDestCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dest.csv")
+	dests := []string{"10.96.0.10:80", "10.96.0.11:80"}
+	latencies := [][]float64{{1, 2, 3}, nil}
+	if err := writeDestCSV(path, dests, latencies, []int64{0, 4}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "dest,position,count,failed,p50_ms,p95_ms,p99_ms,mean_ms\n" +
+		"10.96.0.10:80,0,3,0,2.000,3.000,3.000,2.000\n" +
+		"10.96.0.11:80,1,0,4,0.000,0.000,0.000,0.000\n"
+	if string(data) != want {
+		t.Errorf("dest CSV =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestAIMDNext(t *testing.T) {
+	tests := []struct {
+		rps, p99Ms, want float64
+	}{
+		{50, 8, 55},           // under target: additive increase
+		{50, 10, 55},          // at target
+		{50, 12, 25},          // over: multiplicative decrease
+		{50, math.Inf(1), 25}, // failures
+		{1.5, 12, 1},          // never below 1 RPS
+	}
+	for _, tt := range tests {
+		if got := aimdNext(tt.rps, tt.p99Ms, 10, 5, 0.5); got != tt.want {
+			t.Errorf("aimdNext(%v, p99 %v) = %v, want %v", tt.rps, tt.p99Ms, got, tt.want)
+		}
+	}
+}
+
+func TestConvergedRPS(t *testing.T) {
+	var trajectory []aimdPoint
+	for _, rps := range []float64{10, 15, 20, 25, 12.5, 17.5, 22.5, 11.25} {
+		trajectory = append(trajectory, aimdPoint{rps: rps})
+	}
+	// mean of the second half: 12.5, 17.5, 22.5, 11.25
+	if got := convergedRPS(trajectory); got != 15.9375 {
+		t.Errorf("convergedRPS = %v, want 15.9375", got)
+	}
+	if got := convergedRPS(nil); got != 0 {
+		t.Errorf("convergedRPS(nil) = %v, want 0", got)
+	}
+}
+
+func TestCalibrateBaselineRoundTrip(t *testing.T) {
+	b, err := calibrate(&echoClient{processingNs: 1000}, "10.0.0.5:50051", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Requests != 50 || b.Target != "10.0.0.5:50051" {
+		t.Errorf("baseline = %+v", b)
+	}
+	// In-process echo: the floor is far below a millisecond
+	if b.MinMs > b.P50Ms || b.P50Ms > 1 {
+		t.Errorf("baseline Min=%v ms, P50=%v ms, want Min <= P50 < 1 ms", b.MinMs, b.P50Ms)
+	}
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := writeBaseline(path, b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.P50Ms != b.P50Ms || got.MinMs != b.MinMs || !got.Measured.Equal(b.Measured) {
+		t.Errorf("readBaseline = %+v, want %+v", *got, b)
+	}
+}
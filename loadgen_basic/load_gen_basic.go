@@ -4,10 +4,12 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"time"
 
+	"fyp-onboarding/internal/readiness"
 	pb "fyp-onboarding/workerpb"
 
 	"google.golang.org/grpc"
@@ -16,7 +18,9 @@ import (
 
 func main() {
 	// Command-line flag for worker host:port
-	workerAddr := flag.String("worker", "localhost:50051", "Worker gRPC host:port")
+	workerAddr := flag.String("worker", "localhost:50051", "Worker gRPC host:port, or unix:///path/to.sock for a worker started with -listen unix://...")
+	waitHealthyTimeout := flag.Duration("wait-healthy-timeout", 0, "If > 0, poll the worker's gRPC health service until SERVING before sending")
+	streamMsgs := flag.Int("stream", 0, "If > 0, use DoWorkStream and receive this many messages instead of one DoWork")
 	flag.Parse()
 
 	fmt.Printf("Loadgen Test Script running\n")
@@ -28,7 +32,7 @@ func main() {
 	log.SetOutput(f)
 
 	// Connect to Worker
-	conn, err := grpc.Dial(
+	conn, err := grpc.NewClient(
 		*workerAddr,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 	)
@@ -37,10 +41,28 @@ func main() {
 	}
 	defer conn.Close()
 
+	// Wait for the channel to be READY so the request timing excludes connection setup
+	if err := readiness.WaitForReady(conn, 30*time.Second); err != nil {
+		log.Fatalf("Worker not reachable: %v", err)
+	}
+
 	fmt.Println("Connection successful")
 
+	// Optionally wait for the worker's health service to report SERVING
+	if *waitHealthyTimeout > 0 {
+		if err := readiness.WaitForHealthy(conn, *waitHealthyTimeout); err != nil {
+			log.Fatalf("Worker not healthy: %v", err)
+		}
+		fmt.Println("Worker is SERVING")
+	}
+
 	client := pb.NewWorkerServiceClient(conn)
 
+	if *streamMsgs > 0 {
+		runStream(client, int32(*streamMsgs))
+		return
+	}
+
 	// Send one test request
 	fmt.Println("Sending test request...")
 	start := time.Now()
@@ -53,6 +75,50 @@ func main() {
 	}
 
 	e2e := time.Since(start).Milliseconds()
-	fmt.Printf("Response: Status=%s, WorkerE2E=%dms, ClientE2E=%dms, AvgCPUFreq=%d kHz\n",
-		resp.Status, resp.E2ELatencyMs, e2e, resp.AvgCpuFreqKhz)
+	avgFreq := "N/A"
+	if resp.CpuFreqAvailable {
+		avgFreq = fmt.Sprintf("%d kHz", resp.AvgCpuFreqKhz)
+	}
+	fmt.Printf("Response: Status=%s, WorkerE2E=%dms, ClientE2E=%dms, AvgCPUFreq=%s\n",
+		resp.Status, resp.E2ELatencyMs, e2e, avgFreq)
+}
+
+// runStream opens one DoWorkStream and reports the per-message overhead: the
+// gap between consecutive replies minus the worker's processing time.
+func runStream(client pb.WorkerServiceClient, numMessages int32) {
+	fmt.Printf("Opening stream for %d messages...\n", numMessages)
+	stream, err := client.DoWorkStream(context.Background(), &pb.StreamRequest{
+		Work:        &pb.WorkRequest{DurationMs: 500}, // ask worker to busy-wait 500ms per message
+		NumMessages: numMessages,
+	})
+	if err != nil {
+		log.Fatalf("Stream failed: %v", err)
+	}
+
+	var prevRecv time.Time
+	var sumOverheadNs int64
+	var gaps int64
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Stream recv failed: %v", err)
+		}
+		recv := time.Now()
+		if !prevRecv.IsZero() {
+			gapNs := recv.Sub(prevRecv).Nanoseconds()
+			overheadNs := gapNs - resp.WorkerProcessingNs
+			sumOverheadNs += overheadNs
+			gaps++
+			fmt.Printf("Message %d: Gap=%.3fms, WorkerProcessing=%.3fms, Overhead=%.1fµs\n",
+				gaps+1, float64(gapNs)/1e6, float64(resp.WorkerProcessingNs)/1e6, float64(overheadNs)/1e3)
+		}
+		prevRecv = recv
+	}
+
+	if gaps > 0 {
+		fmt.Printf("Avg inter-message overhead: %.1fµs over %d gaps\n", float64(sumOverheadNs)/float64(gaps)/1e3, gaps)
+	}
 }
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"runtime"
+)
+
+// setCPUAffinity is unavailable outside Linux.
+func setCPUAffinity(cpus []int) error {
+	return errors.New("-cpu-affinity is only supported on Linux")
+}
+
+// usableCPUs returns how many CPUs the process may run on.
+func usableCPUs() int {
+	return runtime.NumCPU()
+}
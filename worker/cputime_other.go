@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "time"
+
+// threadCPUTime is unavailable outside Linux (no RUSAGE_THREAD); CPU time is
+// reported as 0.
+func threadCPUTime() time.Duration {
+	return 0
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// eventBufferSize is how many events may queue for the writer before new ones
+// are dropped rather than blocking DoWork.
+const eventBufferSize = 8192
+
+// requestEvent is one JSONL record of the -events-file stream, keyed by the
+// client-assigned request id so it can be joined with generator-side records.
+type requestEvent struct {
+	ID            string `json:"id"`
+	RecvNs        int64  `json:"recv_ns"`
+	SendNs        int64  `json:"send_ns"`
+	DurationMs    int32  `json:"duration_ms"`
+	WorkMode      string `json:"work_mode"`
+	ProcessingNs  int64  `json:"processing_ns"`
+	Iterations    int64  `json:"iterations"`
+	AvgCPUFreqKhz int64  `json:"avg_cpu_freq_khz"`
+	Status        string `json:"status"`
+}
+
+// eventWriter appends requestEvents to a file from a single goroutine, so the
+// request path only pays for a non-blocking channel send.
+type eventWriter struct {
+	ch      chan requestEvent
+	stop    chan struct{}
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// newEventWriter opens path for appending and starts the writer goroutine,
+// which flushes buffered events every flushInterval.
+func newEventWriter(path string, flushInterval time.Duration) (*eventWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w := &eventWriter{
+		ch:   make(chan requestEvent, eventBufferSize),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go w.run(f, flushInterval)
+	return w, nil
+}
+
+func (w *eventWriter) run(f *os.File, flushInterval time.Duration) {
+	defer close(w.done)
+	defer f.Close()
+	buf := bufio.NewWriter(f)
+	defer buf.Flush()
+	enc := json.NewEncoder(buf)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev := <-w.ch:
+			if err := enc.Encode(ev); err != nil {
+				log.Printf("[Worker] Failed to write event: %v", err)
+			}
+		case <-ticker.C:
+			if err := buf.Flush(); err != nil {
+				log.Printf("[Worker] Failed to flush events: %v", err)
+			}
+		case <-w.stop:
+			// Drain whatever is already queued, then flush on return
+			for {
+				select {
+				case ev := <-w.ch:
+					enc.Encode(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// emit queues ev without blocking; if the writer has fallen behind the event
+// is dropped and counted.
+func (w *eventWriter) emit(ev requestEvent) {
+	select {
+	case w.ch <- ev:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+// Close writes out queued events and closes the file. Events emitted after
+// Close are dropped.
+func (w *eventWriter) Close() {
+	close(w.stop)
+	<-w.done
+	if n := w.dropped.Load(); n > 0 {
+		log.Printf("[Worker] Dropped %d event(s) because the events writer fell behind", n)
+	}
+}
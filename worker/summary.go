@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fyp-onboarding/internal/stats"
+)
+
+// summaryRingSize bounds how many processing times one summary window keeps;
+// past that the oldest samples of the window are overwritten.
+const summaryRingSize = 4096
+
+// windowStats collects served requests between periodic summaries, the
+// server-side counterpart of the loadgen's 20s batch logs.
+type windowStats struct {
+	mu     sync.Mutex
+	served int64
+	ring   [summaryRingSize]float64 // processing times in ms
+	next   int
+
+	// Failed requests, counted here rather than logged one by one
+	injected  atomic.Int64 // -error-rate injected failures
+	abandoned atomic.Int64 // requests the client left before they finished
+}
+
+// record adds one completed request's processing time to the current window.
+func (w *windowStats) record(processingMs float64) {
+	w.mu.Lock()
+	w.ring[w.next%summaryRingSize] = processingMs
+	w.next++
+	w.served++
+	w.mu.Unlock()
+}
+
+// reset returns the window's served count and a copy of its processing
+// times, then starts a new window.
+func (w *windowStats) reset() (int64, []float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	samples := slices.Clone(w.ring[:min(w.next, summaryRingSize)])
+	served := w.served
+	w.served = 0
+	w.next = 0
+	return served, samples
+}
+
+// logSummaries logs throughput and processing time every interval until ctx
+// is done.
+func (s *server) logSummaries(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	windowStart := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			served, samples := s.window.reset()
+			injected, abandoned := s.window.injected.Swap(0), s.window.abandoned.Swap(0)
+			elapsed := now.Sub(windowStart)
+			windowStart = now
+
+			processing := stats.Summary(samples)
+			log.Printf("[Worker] Summary (%s): Served=%d, AchievedRPS=%.1f, MeanProcessing=%.3fms, P95Processing=%.3fms, Active=%d, Injected=%d, Abandoned=%d",
+				elapsed.Round(time.Millisecond), served, float64(served)/elapsed.Seconds(), processing.Mean, processing.P95, s.active.Load(), injected, abandoned)
+		}
+	}
+}
@@ -2,22 +2,111 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"math"
+	"math/rand/v2"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"fyp-onboarding/internal/profiling"
+	"fyp-onboarding/internal/stats"
+	"fyp-onboarding/internal/tracing"
 	pb "fyp-onboarding/workerpb"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+	grpcstatus "google.golang.org/grpc/status"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+var tracer = otel.Tracer("fyp-onboarding/worker")
+
+// ---------------- Prometheus Metrics ----------------
+var activeRequests = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "worker_active_requests",
+		Help: "Number of DoWork requests currently being processed",
+	},
+)
+
+var processingMs = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    "worker_processing_ms",
+		Help:    "Worker processing time (post_busy - pre_busy) in milliseconds",
+		Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 750, 1000, 1500, 2000, 5000},
+	},
+)
+
+var iterationsHist = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    "worker_iterations",
+		Help:    "Number of busy-spin loop iterations per request",
+		Buckets: prometheus.ExponentialBuckets(1000, 4, 10),
+	},
+)
+
+var cpuFreqKhz = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "worker_cpu_freq_khz",
+		Help: "Latest sampled average CPU frequency in kHz",
+	},
 )
 
 type server struct {
 	pb.UnimplementedWorkerServiceServer
+	sampleInterval time.Duration // CPU frequency sampling interval
+	cpuFreqOK      bool          // cpufreq was readable at startup; sampling is skipped otherwise
+	active         atomic.Int64  // requests currently in DoWork, used when draining
+	jsonLogs       bool          // emit structured per-request records via slog
+	debugLogs      bool          // emit text and CLI per-request lines; off at -log-level info (JSON records are filtered by the slog level)
+	window         windowStats   // served requests since the last periodic summary
+	instance       string        // replica identity echoed in every response
+	events         *eventWriter  // per-request JSONL stream; nil when -events-file is unset
+	nodeName       string        // node the replica runs on, if known
+	maxCores       int           // CPUs in the process's affinity mask; upper bound for req.Cores
+
+	// Fault injection: errorRate fraction of DoWork calls fail with errorCode
+	errorRate float64
+	errorCode codes.Code
+	rngMu     sync.Mutex
+	rng       *rand.Rand
+}
+
+// injectFailure reports whether this request should fail, drawing from the
+// seeded generator so a run's failure pattern is reproducible.
+func (s *server) injectFailure() bool {
+	if s.errorRate <= 0 {
+		return false
+	}
+	s.rngMu.Lock()
+	defer s.rngMu.Unlock()
+	return s.rng.Float64() < s.errorRate
 }
 
 func (s *server) DoWork(ctx context.Context, req *pb.WorkRequest) (*pb.WorkResponse, error) {
@@ -25,15 +114,44 @@ func (s *server) DoWork(ctx context.Context, req *pb.WorkRequest) (*pb.WorkRespo
 	arrivalTime := time.Now()
 	arrivalNs := arrivalTime.UnixNano()
 
-	log.Printf("[Worker] Request received: DurationMs=%d, WorkMode=%s, Timestamp=%s",
-		req.DurationMs, req.WorkMode, arrivalTime.Format(time.RFC3339Nano))
+	activeRequests.Inc()
+	defer activeRequests.Dec()
+	s.active.Add(1)
+	defer s.active.Add(-1)
+
+	// The slog handler's level drops per-request records at -log-level info
+	if s.jsonLogs {
+		slog.Debug("request received",
+			"request_id", req.Id,
+			"duration_ms", req.DurationMs,
+			"work_mode", req.WorkMode,
+			"arrival_ns", arrivalNs,
+			"active_requests", s.active.Load())
+	} else if s.debugLogs {
+		log.Printf("[Worker] Request received: ID=%s, DurationMs=%d, WorkMode=%s, Timestamp=%s",
+			req.Id, req.DurationMs, req.WorkMode, arrivalTime.Format(time.RFC3339Nano))
+	}
+
+	if s.injectFailure() {
+		s.window.injected.Add(1)
+		if s.debugLogs {
+			log.Printf("[Worker] Injected failure: ID=%s, Code=%s", req.Id, s.errorCode)
+		}
+		s.emitEvent(req, arrivalNs, 0, 0, 0, "injected_failure")
+		return nil, grpcstatus.Error(s.errorCode, "injected failure")
+	}
+
+	if err := s.validateCores(req.GetCores()); err != nil {
+		return nil, err
+	}
 
 	start := time.Now()
 	duration := time.Duration(req.DurationMs) * time.Millisecond
 	end := time.Now().Add(duration)
 
 	var count int64
-	val := 1.0
+	var coreIterations []int64
+	var cpuTime time.Duration
 
 	// Capture timestamp before busy work
 	preBusyTime := time.Now()
@@ -46,63 +164,94 @@ func (s *server) DoWork(ctx context.Context, req *pb.WorkRequest) (*pb.WorkRespo
 	}
 
 	stopCh := make(chan struct{})
+	samplerDone := make(chan struct{})
 	freqSamples := make([]int64, 0)
-	sampleInterval := 100 * time.Millisecond // cpu sampling rate
 
-	// Start CPU frequency sampler
-	go func() {
-		ticker := time.NewTicker(sampleInterval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				if freq, err := getCPUFreq(); err == nil {
-					freqSamples = append(freqSamples, freq)
+	// Annotate the server span created by the otelgrpc stats handler (no-op when tracing is off)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("work.mode", workMode),
+		attribute.Int("work.duration_ms", int(req.DurationMs)),
+		attribute.String("request.id", req.Id),
+	)
+
+	// Start CPU frequency sampler (irrelevant in sleep mode, the core is idle)
+	if workMode != "sleep" && s.cpuFreqOK {
+		go func() {
+			defer close(samplerDone)
+			ticker := time.NewTicker(s.sampleInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if freq, err := getCPUFreq(); err == nil {
+						freqSamples = append(freqSamples, freq)
+						cpuFreqKhz.Set(float64(freq))
+					}
+				case <-stopCh:
+					return
+				case <-ctx.Done(): // cancel if client disconnects
+					return
 				}
-			case <-stopCh:
-				return
-			case <-ctx.Done(): // cancel if client disconnects
-				return
 			}
-		}
-	}()
+		}()
+	} else {
+		close(samplerDone)
+	}
 
-	// Busy spin loop for requested duration (skip if echo mode)
+	// Busy spin loop for requested duration (skip if echo or sleep mode)
+	_, busySpan := tracer.Start(ctx, "busy_work")
 	if workMode == "echo" {
 		// Echo mode: No busy work, just timestamps
-		log.Printf("[Worker] Echo mode - skipping busy work")
+		if s.debugLogs {
+			log.Printf("[Worker] Echo mode - skipping busy work")
+		}
+	} else if workMode == "sleep" {
+		// Sleep mode: fixed, machine-independent server delay without pinning a core
+		sleepCtx(ctx, duration)
 	} else {
-		// Full mode: Complete CPU-intensive work
-		for time.Now().Before(end) {
-			val = val*1.0001 + 0.9999
-			val = math.Sin(val) + math.Sqrt(val)
-			val = math.Log(val+1.0) + math.Tan(val) + math.Exp(val)
-			val = math.Atan(val) + math.Cosh(val) + math.Sinh(val)
-			count++
-			if val > 1e6 {
-				val = math.Mod(val, 99999)
-			}
+		// Full mode: Complete CPU-intensive work, never past the client's deadline
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(end) {
+			end = deadline
+		}
+		count, coreIterations, cpuTime = runFullWork(ctx, req, end)
+		if len(coreIterations) > 0 && s.debugLogs {
+			log.Printf("[Worker] Multi-core spin: ID=%s, Cores=%d, PerCoreIterations=%v", req.Id, len(coreIterations), coreIterations)
 		}
 	}
 
 	// Capture timestamp after busy work
 	postBusyTime := time.Now()
 	postBusyNs := postBusyTime.UnixNano()
-
-	status := "done"
+	busySpan.SetAttributes(attribute.Int64("work.iterations", count))
+	busySpan.End()
 
 	close(stopCh)
+	<-samplerDone
+
+	// The client's deadline passed or it disconnected; nobody will read the result
+	if err := ctx.Err(); err != nil {
+		s.window.abandoned.Add(1)
+		if s.debugLogs {
+			log.Printf("[Worker] Abandoned request: ID=%s, WorkMode=%s, DurationMs=%d, client left after %.3fms (%v), Iterations=%d",
+				req.Id, workMode, req.DurationMs, float64(postBusyNs-arrivalNs)/1e6, err, count)
+		}
+		s.emitEvent(req, arrivalNs, postBusyNs-preBusyNs, count, 0, "abandoned")
+		return nil, grpcstatus.FromContextError(err).Err()
+	}
+
+	status := "done"
 
-	// Compute average CPU frequency
-	var avgFreq int64
-	if len(freqSamples) > 0 {
-		var sum int64
-		for _, f := range freqSamples {
-			sum += f
+	// Requests shorter than the sample interval get no ticks; take one sample at the end
+	if len(freqSamples) == 0 && workMode != "sleep" && s.cpuFreqOK {
+		if freq, err := getCPUFreq(); err == nil {
+			freqSamples = append(freqSamples, freq)
+			cpuFreqKhz.Set(float64(freq))
 		}
-		avgFreq = sum / int64(len(freqSamples))
 	}
 
+	// Compute CPU frequency statistics
+	avgFreq, minFreq, maxFreq, p5Freq := summarizeFreq(freqSamples)
+
 	// Capture response timestamp
 	responseTime := time.Now()
 	responseNs := responseTime.UnixNano()
@@ -110,16 +259,49 @@ func (s *server) DoWork(ctx context.Context, req *pb.WorkRequest) (*pb.WorkRespo
 	e2e := time.Since(start).Milliseconds()
 	workerProcessingNs := postBusyNs - preBusyNs
 	workerProcessingMs := float64(workerProcessingNs) / 1e6
+	cpuTimeMs := float64(cpuTime) / 1e6
+	var achievedUtilPct float64
+	if workMode == "full" && workerProcessingNs > 0 {
+		achievedUtilPct = 100 * float64(cpuTime) / float64(workerProcessingNs) / float64(max(req.GetCores(), 1))
+	}
 	totalLatencyNs := responseNs - arrivalNs
 	totalLatencyMs := float64(totalLatencyNs) / 1e6
 
-	log.Printf("[Worker] Finished request: WorkMode=%s, DurationMs=%d, E2ELatencyMs=%d, TotalLatency=%.3fms, WorkerProcessing=%.3fms, Iterations=%d, AvgCPUFreq=%d kHz, Status=%s",
-		workMode, req.DurationMs, e2e, totalLatencyMs, workerProcessingMs, count, avgFreq, status)
-	fmt.Printf("[Worker CLI] Request finished: WorkMode=%s, DurationMs=%d, E2E=%d ms, TotalLatency=%.3fms, Processing=%.3fms, Iterations=%d, AvgCPUFreq=%d kHz, Status=%s\n",
-		workMode, req.DurationMs, e2e, totalLatencyMs, workerProcessingMs, count, avgFreq, status)
+	processingMs.Observe(workerProcessingMs)
+	iterationsHist.Observe(float64(count))
+	s.window.record(workerProcessingMs)
+	s.emitEvent(req, arrivalNs, workerProcessingNs, count, avgFreq, status)
+
+	if s.jsonLogs {
+		slog.Debug("request finished",
+			"request_id", req.Id,
+			"work_mode", workMode,
+			"duration_ms", req.DurationMs,
+			"e2e_ms", e2e,
+			"total_latency_ms", totalLatencyMs,
+			"processing_ms", workerProcessingMs,
+			"cpu_time_ms", cpuTimeMs,
+			"achieved_util_pct", achievedUtilPct,
+			"iterations", count,
+			"avg_freq_khz", avgFreq,
+			"min_freq_khz", minFreq,
+			"max_freq_khz", maxFreq,
+			"p5_freq_khz", p5Freq,
+			"status", status,
+			"active_requests", s.active.Load())
+	}
+	if s.debugLogs {
+		if !s.jsonLogs {
+			log.Printf("[Worker] Finished request: ID=%s, WorkMode=%s, DurationMs=%d, E2ELatencyMs=%d, TotalLatency=%.3fms, WorkerProcessing=%.3fms, CPUTime=%.3fms, AchievedUtil=%.1f%%, Iterations=%d, AvgCPUFreq=%d kHz, MinCPUFreq=%d kHz, MaxCPUFreq=%d kHz, P5CPUFreq=%d kHz, Status=%s",
+				req.Id, workMode, req.DurationMs, e2e, totalLatencyMs, workerProcessingMs, cpuTimeMs, achievedUtilPct, count, avgFreq, minFreq, maxFreq, p5Freq, status)
+		}
+		fmt.Printf("[Worker CLI] Request finished: ID=%s, WorkMode=%s, DurationMs=%d, E2E=%d ms, TotalLatency=%.3fms, Processing=%.3fms, CPUTime=%.3fms, Iterations=%d, AvgCPUFreq=%d kHz, Status=%s\n",
+			req.Id, workMode, req.DurationMs, e2e, totalLatencyMs, workerProcessingMs, cpuTimeMs, count, avgFreq, status)
+	}
 
 	// Return comprehensive response with high-precision timestamps
 	return &pb.WorkResponse{
+		ResponsePadBytes:    responsePad(req.ResponsePadSize),
 		Status:              status,
 		E2ELatencyMs:        e2e,
 		AvgCpuFreqKhz:       avgFreq,
@@ -129,9 +311,327 @@ func (s *server) DoWork(ctx context.Context, req *pb.WorkRequest) (*pb.WorkRespo
 		PostBusyTimestampNs: postBusyNs,
 		ResponseTimestampNs: responseNs,
 		WorkerProcessingNs:  workerProcessingNs,
+		MinCpuFreqKhz:       minFreq,
+		MaxCpuFreqKhz:       maxFreq,
+		P5CpuFreqKhz:        p5Freq,
+		Id:                  req.Id,
+		CoreIterations:      coreIterations,
+		WorkerCpuTimeMs:     cpuTimeMs,
+		AchievedUtilPct:     achievedUtilPct,
+		CpuFreqAvailable:    s.cpuFreqOK && len(freqSamples) > 0,
+		WorkerInstance:      s.instance,
+		NodeName:            s.nodeName,
 	}, nil
 }
 
+// emitEvent queues one -events-file record for req, stamped with the current
+// time as its send time.
+func (s *server) emitEvent(req *pb.WorkRequest, arrivalNs, processingNs, iterations, avgFreq int64, status string) {
+	if s.events == nil {
+		return
+	}
+	workMode := req.WorkMode
+	if workMode == "" {
+		workMode = "full"
+	}
+	s.events.emit(requestEvent{
+		ID:            req.Id,
+		RecvNs:        arrivalNs,
+		SendNs:        time.Now().UnixNano(),
+		DurationMs:    req.DurationMs,
+		WorkMode:      workMode,
+		ProcessingNs:  processingNs,
+		Iterations:    iterations,
+		AvgCPUFreqKhz: avgFreq,
+		Status:        status,
+	})
+}
+
+// DoWorkStream performs the requested work repeatedly on a single stream,
+// sending one WorkResponse per completed tick. Only the per-message cost is
+// paid after the first reply, which isolates proxying cost from stream setup.
+func (s *server) DoWorkStream(req *pb.StreamRequest, stream grpc.ServerStreamingServer[pb.WorkResponse]) error {
+	work := req.GetWork()
+	workMode := work.GetWorkMode()
+	if workMode == "" {
+		workMode = "full"
+	}
+	duration := time.Duration(work.GetDurationMs()) * time.Millisecond
+	if err := s.validateCores(work.GetCores()); err != nil {
+		return err
+	}
+
+	activeRequests.Inc()
+	defer activeRequests.Dec()
+	s.active.Add(1)
+	defer s.active.Add(-1)
+
+	log.Printf("[Worker] Stream opened: ID=%s, DurationMs=%d, WorkMode=%s, NumMessages=%d",
+		work.GetId(), work.GetDurationMs(), workMode, req.NumMessages)
+
+	var sent int32
+	for req.NumMessages == 0 || sent < req.NumMessages {
+		if err := stream.Context().Err(); err != nil {
+			log.Printf("[Worker] Stream closed by client after %d messages", sent)
+			return nil
+		}
+
+		tickStart := time.Now()
+		var count int64
+		var coreIterations []int64
+		var cpuTime time.Duration
+		switch workMode {
+		case "echo":
+		case "sleep":
+			sleepCtx(stream.Context(), duration)
+		default:
+			count, coreIterations, cpuTime = runFullWork(stream.Context(), work, tickStart.Add(duration))
+		}
+		postBusy := time.Now()
+
+		processingNs := postBusy.UnixNano() - tickStart.UnixNano()
+		processingMs.Observe(float64(processingNs) / 1e6)
+		iterationsHist.Observe(float64(count))
+		s.window.record(float64(processingNs) / 1e6)
+
+		err := stream.Send(&pb.WorkResponse{
+			ResponsePadBytes:    responsePad(work.GetResponsePadSize()),
+			Status:              "done",
+			E2ELatencyMs:        time.Since(tickStart).Milliseconds(),
+			Iterations:          count,
+			ArrivalTimestampNs:  tickStart.UnixNano(),
+			PreBusyTimestampNs:  tickStart.UnixNano(),
+			PostBusyTimestampNs: postBusy.UnixNano(),
+			ResponseTimestampNs: time.Now().UnixNano(),
+			WorkerProcessingNs:  processingNs,
+			Id:                  work.GetId(),
+			CoreIterations:      coreIterations,
+			WorkerCpuTimeMs:     float64(cpuTime) / 1e6,
+			WorkerInstance:      s.instance,
+			NodeName:            s.nodeName,
+		})
+		if err != nil {
+			log.Printf("[Worker] Stream send failed after %d messages: %v", sent, err)
+			return err
+		}
+		sent++
+	}
+
+	log.Printf("[Worker] Stream finished: WorkMode=%s, DurationMs=%d, Messages=%d", workMode, work.GetDurationMs(), sent)
+	return nil
+}
+
+// spinSink receives the final value of every spin loop so the compiler can
+// never treat the loop body as dead code.
+var spinSink atomic.Uint64
+
+// maxResponsePad keeps padded responses under gRPC's default 4 MiB message limit.
+const maxResponsePad = 4<<20 - 64<<10
+
+// responsePad returns a zero-filled padding payload of the requested size,
+// clamped to [0, maxResponsePad].
+func responsePad(size int32) []byte {
+	if size <= 0 {
+		return nil
+	}
+	return make([]byte, min(int(size), maxResponsePad))
+}
+
+// validateCores rejects core counts the worker cannot run in parallel. Each
+// core is a goroutine holding its own OS thread, so an unbounded count could
+// exhaust the runtime's thread limit and crash the worker.
+func (s *server) validateCores(cores int32) error {
+	if cores < 0 || int(cores) > s.maxCores {
+		return grpcstatus.Errorf(codes.InvalidArgument, "cores must be between 0 and %d, got %d", s.maxCores, cores)
+	}
+	return nil
+}
+
+// runFullWork performs the CPU-intensive part of a "full" request: a fixed
+// number of iterations if req.Iterations is set (CPU-invariant workload),
+// otherwise spinning until end. With req.Cores > 1 the same work runs on that
+// many OS-thread-pinned goroutines. It returns the total iteration count, the
+// per-core counts for multi-core requests, and the summed thread CPU time of
+// the spinning threads.
+func runFullWork(ctx context.Context, req *pb.WorkRequest, end time.Time) (int64, []int64, time.Duration) {
+	// work runs on a locked OS thread so getrusage(RUSAGE_THREAD) covers exactly the spin
+	work := func() (int64, time.Duration) {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		cpuStart := threadCPUTime()
+		var n int64
+		if req.GetIterations() > 0 {
+			n = spinIterations(ctx, req.GetIterations())
+		} else if util := req.GetTargetUtilPct(); util > 0 && util < 100 {
+			n = dutyCycleSpin(ctx, end, util)
+		} else {
+			n = busySpin(ctx, end)
+		}
+		return n, threadCPUTime() - cpuStart
+	}
+
+	cores := int(req.GetCores())
+	if cores <= 1 {
+		n, cpu := work()
+		return n, nil, cpu
+	}
+
+	perCore := make([]int64, cores)
+	perCoreCPU := make([]time.Duration, cores)
+	var wg sync.WaitGroup
+	for i := range cores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			perCore[i], perCoreCPU[i] = work()
+		}()
+	}
+	wg.Wait()
+
+	var total int64
+	var cpu time.Duration
+	for i := range perCore {
+		total += perCore[i]
+		cpu += perCoreCPU[i]
+	}
+	return total, perCore, cpu
+}
+
+// ctxCheckEvery is how many spin iterations run between context checks.
+const ctxCheckEvery = 256
+
+// busySpin runs the CPU-intensive loop until end or until ctx is done, and
+// returns the number of iterations completed.
+func busySpin(ctx context.Context, end time.Time) int64 {
+	return spinUntil(ctx, end, time.Now)
+}
+
+// spinUntil is busySpin with the clock passed in, so tests can drive the
+// deadline check with a fake one. Production code always passes time.Now.
+func spinUntil(ctx context.Context, end time.Time, now func() time.Time) int64 {
+	var count int64
+	val := 1.0
+	for now().Before(end) {
+		val = spinStep(val)
+		count++
+		if count%ctxCheckEvery == 0 && ctx.Err() != nil {
+			break
+		}
+	}
+	spinSink.Store(math.Float64bits(val))
+	return count
+}
+
+// dutyCyclePeriod is one spin+sleep cycle of dutyCycleSpin; short enough that
+// utilization averages out within a typical request.
+const dutyCyclePeriod = 10 * time.Millisecond
+
+// dutyCycleSpin alternates spinning for utilPct% of each dutyCyclePeriod and
+// sleeping for the rest until end or until ctx is done, and returns the
+// number of iterations completed.
+func dutyCycleSpin(ctx context.Context, end time.Time, utilPct int32) int64 {
+	spinPart := dutyCyclePeriod * time.Duration(utilPct) / 100
+	var count int64
+	for periodStart := time.Now(); periodStart.Before(end) && ctx.Err() == nil; periodStart = time.Now() {
+		count += busySpin(ctx, minTime(periodStart.Add(spinPart), end))
+		sleepCtx(ctx, time.Until(minTime(periodStart.Add(dutyCyclePeriod), end)))
+	}
+	return count
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// spinIterations runs exactly n iterations of the spin loop regardless of how
+// long they take, stopping early only if ctx is done. It returns the number of
+// iterations completed.
+func spinIterations(ctx context.Context, n int64) int64 {
+	val := 1.0
+	var done int64
+	for done < n {
+		val = spinStep(val)
+		done++
+		if done%ctxCheckEvery == 0 && ctx.Err() != nil {
+			break
+		}
+	}
+	spinSink.Store(math.Float64bits(val))
+	return done
+}
+
+// sleepCtx sleeps for d or until ctx is done, whichever comes first.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// spinStep is one iteration of the CPU-intensive math loop.
+func spinStep(val float64) float64 {
+	val = val*1.0001 + 0.9999
+	val = math.Sin(val) + math.Sqrt(val)
+	val = math.Log(val+1.0) + math.Tan(val) + math.Exp(val)
+	val = math.Atan(val) + math.Cosh(val) + math.Sinh(val)
+	if val > 1e6 {
+		val = math.Mod(val, 99999)
+	}
+	return val
+}
+
+// summarizeFreq returns the average, minimum, maximum and 5th percentile
+// (nearest-rank) of the sampled CPU frequencies. All values are 0 if no
+// samples were taken.
+func summarizeFreq(samples []int64) (avg, lowest, highest, p5 int64) {
+	if len(samples) == 0 {
+		return 0, 0, 0, 0
+	}
+
+	values := make([]float64, len(samples))
+	var sum int64
+	for i, f := range samples {
+		values[i] = float64(f)
+		sum += f
+	}
+	summary := stats.Summary(values)
+	return sum / int64(len(samples)), int64(summary.Min), int64(summary.Max), int64(stats.Percentile(values, 5))
+}
+
+// GetNodeStats reports conntrack table occupancy so the generator can
+// correlate it with latency drift during long runs.
+func (s *server) GetNodeStats(ctx context.Context, req *pb.NodeStatsRequest) (*pb.NodeStatsResponse, error) {
+	resp := &pb.NodeStatsResponse{
+		WorkerInstance: s.instance,
+		TimestampNs:    time.Now().UnixNano(),
+	}
+	count, countErr := readProcInt("/proc/sys/net/netfilter/nf_conntrack_count")
+	limit, maxErr := readProcInt("/proc/sys/net/netfilter/nf_conntrack_max")
+	if countErr == nil && maxErr == nil {
+		resp.ConntrackAvailable = true
+		resp.ConntrackCount = count
+		resp.ConntrackMax = limit
+	}
+	return resp, nil
+}
+
+// readProcInt reads a single integer from a /proc or /sys file.
+func readProcInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// cpuFreqProbePath is read at startup to decide whether cpufreq is available.
+const cpuFreqProbePath = "/sys/devices/system/cpu/cpu0/cpufreq/scaling_cur_freq"
+
 func getCPUFreq() (int64, error) {
 	const numCores = 20
 	var sum int64
@@ -164,24 +664,344 @@ func getCPUFreq() (int64, error) {
 	return avg, nil
 }
 
+// serverCredentials builds TLS server credentials from the given certificate
+// and key. If caFile is set, clients must present a certificate signed by it.
+func serverCredentials(certFile, keyFile, caFile string) (credentials.TransportCredentials, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("-cert and -key are required with -tls")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load key pair: %w", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// parseCode maps a gRPC status code name such as "Unavailable" to its code.
+func parseCode(name string) (codes.Code, error) {
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if strings.EqualFold(c.String(), name) {
+			return c, nil
+		}
+	}
+	return codes.Unknown, fmt.Errorf("unknown gRPC status code %q", name)
+}
+
+// listen opens the gRPC listener. A unix:// address listens on a unix-domain
+// socket, removing a stale socket left by a previous run; anything else is TCP.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix://")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// parseCPUList parses a comma-separated CPU list such as "2,3".
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, field := range strings.Split(list, ",") {
+		cpu, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || cpu < 0 {
+			return nil, fmt.Errorf("invalid CPU %q in %q", field, list)
+		}
+		cpus = append(cpus, cpu)
+	}
+	return cpus, nil
+}
+
 func main() {
+	listenAddr := flag.String("listen", "", "gRPC listen address: host:port, or unix:///path/to.sock for a unix socket (default :$PORT)")
+	metricsPort := flag.String("metrics-port", "9100", "Port for the Prometheus /metrics endpoint (not 9090: the loadgen and Knative's queue-proxy use it)")
+	freqSampleMs := flag.Int("freq-sample-ms", 100, "CPU frequency sampling interval in milliseconds")
+	useTLS := flag.Bool("tls", false, "Serve gRPC over TLS (requires -cert and -key)")
+	certFile := flag.String("cert", "", "TLS certificate file")
+	keyFile := flag.String("key", "", "TLS private key file")
+	caFile := flag.String("ca", "", "CA bundle for verifying client certificates (enables mTLS)")
+	enableReflection := flag.Bool("reflection", true, "Register gRPC server reflection (for grpcurl debugging)")
+	// Keepalive enforcement: clients pinging more often than -keepalive-min-time
+	// get GOAWAY (too_many_pings), so keep it <= the generator's -keepalive-time.
+	keepaliveMinTime := flag.Duration("keepalive-min-time", 10*time.Second, "Minimum interval allowed between client keepalive pings")
+	keepalivePermitWithoutStream := flag.Bool("keepalive-permit-without-stream", true, "Allow client keepalive pings when there are no active RPCs")
+	// HTTP/2 limits. Streams beyond -max-streams queue on the client's connection,
+	// which shows up as latency, so set it to at least the generator's peak number
+	// of in-flight requests per connection. Window sizes of 64KiB or more turn off
+	// gRPC's BDP-based window tuning; leave them at 0 unless payloads are large.
+	maxStreams := flag.Uint("max-streams", 0, "HTTP/2 max concurrent streams per connection (0 = gRPC default, effectively unlimited)")
+	initialWindowSize := flag.Int("initial-window-size", 0, "HTTP/2 initial per-stream flow-control window in bytes (0 = gRPC default)")
+	initialConnWindowSize := flag.Int("initial-conn-window-size", 0, "HTTP/2 initial per-connection flow-control window in bytes (0 = gRPC default)")
+	pprofAddr := flag.String("pprof-addr", "", "Serve net/http/pprof on this address, e.g. :6060 (disabled if empty)")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/gRPC collector host:port for trace export (disabled if empty)")
+	errorRate := flag.Float64("error-rate", 0, "Fraction of DoWork calls (0.0-1.0) that fail instead of doing work")
+	errorCodeName := flag.String("error-code", "Unavailable", "gRPC status code returned for injected failures, e.g. Unavailable, ResourceExhausted")
+	seed := flag.Uint64("seed", 0, "Seed for injected-failure selection (0 = time-based)")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	logLevel := flag.String("log-level", "debug", "Log level: debug (per-request lines) or info (startup/shutdown and errors only)")
+	logFile := flag.String("log-file", "", "Also write logs to this file, rotated by size (disabled if empty)")
+	logMaxSizeMB := flag.Int("log-max-size-mb", 100, "Rotate -log-file once it reaches this many megabytes")
+	logMaxBackups := flag.Int("log-max-backups", 5, "Number of rotated -log-file backups to keep")
+	logStderr := flag.Bool("log-stderr", true, "Write logs to stderr (disable to log only to -log-file)")
+	summaryInterval := flag.Duration("summary-interval", 20*time.Second, "Log a throughput/processing-time summary at this interval (0 disables)")
+	// Pair -cpu-affinity with kernel isolcpus=<same cpus> (and ideally nohz_full)
+	// so nothing else is scheduled there and the spin loop is not migrated.
+	cpuAffinity := flag.String("cpu-affinity", "", "Comma-separated CPUs to pin the worker process to, e.g. 2,3 (disabled if empty)")
+	eventsFile := flag.String("events-file", "", "Append one JSON line per DoWork request to this file (disabled if empty)")
+	eventsFlushInterval := flag.Duration("events-flush-interval", time.Second, "How often buffered -events-file lines are flushed to disk")
+	drainTimeout := flag.Duration("drain-timeout", 30*time.Second, "Max time to drain in-flight requests on SIGINT/SIGTERM before forcing stop")
+	flag.Parse()
+
+	// Per-request lines are DEBUG; info keeps only startup/shutdown and errors
+	var level slog.Level
+	switch *logLevel {
+	case "debug":
+		level = slog.LevelDebug
+	case "info":
+		level = slog.LevelInfo
+	default:
+		log.Fatalf("[Worker] unknown -log-level %q (want debug or info)", *logLevel)
+	}
+
+	// Logs go to stderr and/or a size-rotated file
+	var logOutputs []io.Writer
+	if *logStderr {
+		logOutputs = append(logOutputs, os.Stderr)
+	}
+	if *logFile != "" {
+		rotator := &lumberjack.Logger{
+			Filename:   *logFile,
+			MaxSize:    *logMaxSizeMB,
+			MaxBackups: *logMaxBackups,
+		}
+		defer rotator.Close()
+		logOutputs = append(logOutputs, rotator)
+	}
+	if len(logOutputs) == 0 {
+		log.Fatalf("[Worker] -log-stderr=false requires -log-file")
+	}
+	logOut := io.MultiWriter(logOutputs...)
+	log.SetOutput(logOut)
+
+	// JSON mode routes every log line through slog; per-request lines get structured fields
+	switch *logFormat {
+	case "text":
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(logOut, &slog.HandlerOptions{Level: level})))
+	default:
+		log.Fatalf("[Worker] unknown -log-format %q (want text or json)", *logFormat)
+	}
+
+	if *errorRate < 0 || *errorRate > 1 {
+		log.Fatalf("[Worker] -error-rate must be within [0, 1], got %g", *errorRate)
+	}
+	errorCode, err := parseCode(*errorCodeName)
+	if err != nil {
+		log.Fatalf("[Worker] %v", err)
+	}
+	if *seed == 0 {
+		*seed = uint64(time.Now().UnixNano())
+	}
+	if *errorRate > 0 {
+		log.Printf("[Worker] Injecting %s on %.1f%% of requests (seed %d)", errorCode, *errorRate*100, *seed)
+	}
+
+	if *freqSampleMs <= 0 {
+		log.Fatalf("[Worker] -freq-sample-ms must be positive, got %d", *freqSampleMs)
+	}
+
+	// Without cpufreq (VMs, some containers) every sample would fail; detect it once
+	cpuFreqOK := true
+	if _, err := readProcInt(cpuFreqProbePath); err != nil {
+		cpuFreqOK = false
+		log.Printf("[Worker] WARNING: CPU frequency unavailable (%v); freq sampling disabled and responses report cpu_freq_available=false", err)
+	}
+
+	// Pin before the server starts so every runtime thread inherits the mask
+	if *cpuAffinity != "" {
+		cpus, err := parseCPUList(*cpuAffinity)
+		if err != nil {
+			log.Fatalf("[Worker] -cpu-affinity: %v", err)
+		}
+		if err := setCPUAffinity(cpus); err != nil {
+			log.Fatalf("[Worker] failed to set CPU affinity: %v", err)
+		}
+		log.Printf("[Worker] Pinned to CPUs %v", cpus)
+	}
+	maxCores := usableCPUs()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "50051"
 	}
 
-	lis, err := net.Listen("tcp", ":"+port)
+	// Replica identity for per-endpoint tallies in the generator
+	instance := os.Getenv("WORKER_INSTANCE")
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	nodeName := os.Getenv("NODE_NAME")
+
+	if *pprofAddr != "" {
+		profiling.Start(*pprofAddr, "[Worker] ")
+	}
+
+	// Start Prometheus metrics server
+	prometheus.MustRegister(activeRequests, processingMs, iterationsHist, cpuFreqKhz)
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		log.Printf("[Worker] Metrics listening on port :%s", *metricsPort)
+		if err := http.ListenAndServe(":"+*metricsPort, mux); err != nil {
+			log.Printf("[Worker] metrics server stopped: %v", err)
+		}
+	}()
+
+	if *listenAddr == "" {
+		*listenAddr = ":" + port
+	}
+	lis, err := listen(*listenAddr)
 	if err != nil {
 		log.Fatalf("[Worker] failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
-	pb.RegisterWorkerServiceServer(s, &server{})
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             *keepaliveMinTime,
+			PermitWithoutStream: *keepalivePermitWithoutStream,
+		}),
+	}
+	// gRPC silently ignores windows below 64KiB, so reject them instead
+	for name, size := range map[string]int{"initial-window-size": *initialWindowSize, "initial-conn-window-size": *initialConnWindowSize} {
+		if size != 0 && (size < 64*1024 || size > math.MaxInt32) {
+			log.Fatalf("[Worker] -%s must be 0 or between 65536 and %d, got %d", name, math.MaxInt32, size)
+		}
+	}
+	if *maxStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(uint32(*maxStreams)))
+	}
+	if *initialWindowSize > 0 {
+		opts = append(opts, grpc.InitialWindowSize(int32(*initialWindowSize)))
+	}
+	if *initialConnWindowSize > 0 {
+		opts = append(opts, grpc.InitialConnWindowSize(int32(*initialConnWindowSize)))
+	}
+	if *maxStreams > 0 || *initialWindowSize > 0 || *initialConnWindowSize > 0 {
+		log.Printf("[Worker] HTTP/2 limits: MaxStreams=%d, InitialWindow=%d, InitialConnWindow=%d (0 = gRPC default)",
+			*maxStreams, *initialWindowSize, *initialConnWindowSize)
+	}
+	if *useTLS {
+		creds, err := serverCredentials(*certFile, *keyFile, *caFile)
+		if err != nil {
+			log.Fatalf("[Worker] failed to load TLS credentials: %v", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+		log.Printf("[Worker] TLS enabled (mTLS=%t)", *caFile != "")
+	}
 
-	log.Printf("[Worker] Listening on port :%s", port)
-	fmt.Printf("[Worker CLI] Worker started on port :%s\n", port)
+	if *otlpEndpoint != "" {
+		shutdownTracing, err := tracing.Init(context.Background(), *otlpEndpoint, "worker")
+		if err != nil {
+			log.Fatalf("[Worker] failed to init tracing: %v", err)
+		}
+		defer shutdownTracing(context.Background())
+		opts = append(opts, grpc.StatsHandler(otelgrpc.NewServerHandler()))
+		log.Printf("[Worker] Tracing enabled, exporting to %s", *otlpEndpoint)
+	}
+
+	s := grpc.NewServer(opts...)
+	srv := &server{
+		sampleInterval: time.Duration(*freqSampleMs) * time.Millisecond,
+		cpuFreqOK:      cpuFreqOK,
+		jsonLogs:       *logFormat == "json",
+		debugLogs:      level <= slog.LevelDebug,
+		errorRate:      *errorRate,
+		errorCode:      errorCode,
+		rng:            rand.New(rand.NewPCG(*seed, *seed)),
+		instance:       instance,
+		nodeName:       nodeName,
+		maxCores:       maxCores,
+	}
+	if *eventsFile != "" {
+		if *eventsFlushInterval <= 0 {
+			log.Fatalf("[Worker] -events-flush-interval must be positive, got %s", *eventsFlushInterval)
+		}
+		events, err := newEventWriter(*eventsFile, *eventsFlushInterval)
+		if err != nil {
+			log.Fatalf("[Worker] failed to open events file: %v", err)
+		}
+		srv.events = events
+		log.Printf("[Worker] Writing request events to %s", *eventsFile)
+	}
+	pb.RegisterWorkerServiceServer(s, srv)
+
+	// Standard gRPC health service so generators can wait for readiness
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(s, healthSrv)
+
+	if *enableReflection {
+		reflection.Register(s)
+	}
+
+	// Rolling server-side summary, mirroring the loadgen's batch logs
+	if *summaryInterval > 0 {
+		summaryCtx, stopSummaries := context.WithCancel(context.Background())
+		defer stopSummaries()
+		go srv.logSummaries(summaryCtx, *summaryInterval)
+	}
+
+	// Graceful shutdown: stop accepting new RPCs and drain in-flight ones
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		sig := <-sigCh
+		healthSrv.Shutdown() // report NOT_SERVING while draining
+		inFlight := srv.active.Load()
+		log.Printf("[Worker] Received %s, draining %d in-flight request(s) (timeout %s)", sig, inFlight, *drainTimeout)
+
+		stopped := make(chan struct{})
+		go func() {
+			s.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+			log.Printf("[Worker] Drained %d request(s), shutdown complete", inFlight)
+		case <-time.After(*drainTimeout):
+			log.Printf("[Worker] Drain timeout exceeded with %d request(s) still active, forcing stop", srv.active.Load())
+			s.Stop()
+		}
+	}()
+
+	healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthSrv.SetServingStatus(pb.WorkerService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	log.Printf("[Worker] Listening on %s (instance %s, node %q)", *listenAddr, instance, nodeName)
+	fmt.Printf("[Worker CLI] Worker started on %s\n", *listenAddr)
 
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("[Worker] failed to serve: %v", err)
 	}
+	<-shutdownDone
+	if srv.events != nil {
+		srv.events.Close()
+	}
 }
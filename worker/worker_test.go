@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSummarizeFreq(t *testing.T) {
+	tests := []struct {
+		name                             string
+		samples                          []int64
+		wantAvg, wantMin, wantMax, want5 int64
+	}{
+		{"empty", nil, 0, 0, 0, 0},
+		{"one sample", []int64{2400000}, 2400000, 2400000, 2400000, 2400000},
+		{"unsorted", []int64{3000000, 1200000, 2400000, 1800000}, 2100000, 1200000, 3000000, 1200000},
+		// 20 samples: nearest-rank p5 is the 1st smallest, p5 of 21 is the 2nd
+		{"p5 rank", append([]int64{1000}, repeat(2000, 19)...), 1950, 1000, 2000, 1000},
+		{"p5 rank past 20", append([]int64{1000, 1500}, repeat(2000, 19)...), 1928, 1000, 2000, 1500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			avg, lowest, highest, p5 := summarizeFreq(tt.samples)
+			if avg != tt.wantAvg || lowest != tt.wantMin || highest != tt.wantMax || p5 != tt.want5 {
+				t.Errorf("summarizeFreq = (%d, %d, %d, %d), want (%d, %d, %d, %d)",
+					avg, lowest, highest, p5, tt.wantAvg, tt.wantMin, tt.wantMax, tt.want5)
+			}
+		})
+	}
+}
+
+func TestSummarizeFreqDoesNotModifyInput(t *testing.T) {
+	samples := []int64{3, 1, 2}
+	summarizeFreq(samples)
+	if samples[0] != 3 || samples[1] != 1 || samples[2] != 2 {
+		t.Errorf("summarizeFreq reordered its input: %v", samples)
+	}
+}
+
+// repeat returns n copies of f.
+func repeat(f int64, n int) []int64 {
+	samples := make([]int64, n)
+	for i := range samples {
+		samples[i] = f
+	}
+	return samples
+}
+
+// TestBusySpinScalesLinearly checks that iterations grow roughly in
+// proportion to spin time, i.e. the loop body is not optimized away.
+func TestBusySpinScalesLinearly(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing-sensitive")
+	}
+	short := busySpin(context.Background(), time.Now().Add(20*time.Millisecond))
+	long := busySpin(context.Background(), time.Now().Add(80*time.Millisecond))
+	if short == 0 {
+		t.Fatal("busySpin did no iterations in 20ms")
+	}
+	// 4x the time should give about 4x the iterations; leave room for a noisy machine
+	if ratio := float64(long) / float64(short); ratio < 2 || ratio > 8 {
+		t.Errorf("80ms/20ms iteration ratio = %.2f (%d/%d), want about 4", ratio, long, short)
+	}
+}
+
+func BenchmarkBusySpin(b *testing.B) {
+	for _, d := range []time.Duration{time.Millisecond, 10 * time.Millisecond} {
+		b.Run(d.String(), func(b *testing.B) {
+			var iters int64
+			for b.Loop() {
+				iters += busySpin(context.Background(), time.Now().Add(d))
+			}
+			b.ReportMetric(float64(iters)/float64(b.N)/float64(d.Microseconds()), "iters/µs")
+		})
+	}
+}
+
+// fakeClock returns a clock starting at start that advances by tick on every
+// reading, so a spin loop sees a fixed number of readings before its deadline
+// however fast the machine is.
+func fakeClock(start time.Time, tick time.Duration) func() time.Time {
+	now := start
+	return func() time.Time {
+		t := now
+		now = now.Add(tick)
+		return t
+	}
+}
+
+func TestSpinUntilStopsAtDeadline(t *testing.T) {
+	start := time.Unix(0, 0)
+	now := fakeClock(start, time.Millisecond)
+
+	if got := spinUntil(context.Background(), start.Add(10*time.Millisecond), now); got != 10 {
+		t.Errorf("spinUntil to a 10ms deadline with 1ms ticks = %d iterations, want 10", got)
+	}
+}
+
+func TestSpinUntilStopsOnCancel(t *testing.T) {
+	start := time.Unix(0, 0)
+	now := fakeClock(start, 0) // time never passes
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := spinUntil(ctx, start.Add(time.Hour), now); got != ctxCheckEvery {
+		t.Errorf("spinUntil with a canceled context = %d iterations, want %d", got, ctxCheckEvery)
+	}
+}
+
+func TestSpinIterations(t *testing.T) {
+	for _, n := range []int64{0, 1, ctxCheckEvery + 1, 10000} {
+		if got := spinIterations(context.Background(), n); got != n {
+			t.Errorf("spinIterations(%d) = %d", n, got)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := spinIterations(ctx, 10000); got != ctxCheckEvery {
+		t.Errorf("spinIterations with a canceled context = %d, want %d", got, ctxCheckEvery)
+	}
+}
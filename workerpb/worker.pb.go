@@ -23,11 +23,18 @@ const (
 
 // Request from Load Generator
 type WorkRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	DurationMs    int32                  `protobuf:"varint,1,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"` // CPU spin duration in milliseconds
-	WorkMode      string                 `protobuf:"bytes,2,opt,name=work_mode,json=workMode,proto3" json:"work_mode,omitempty"`        // Work mode: "full" (default) or "echo"
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	DurationMs int32                  `protobuf:"varint,1,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"` // CPU spin duration in milliseconds
+	WorkMode   string                 `protobuf:"bytes,2,opt,name=work_mode,json=workMode,proto3" json:"work_mode,omitempty"`        // Work mode: "full" (default), "echo" or "sleep"
+	Id         string                 `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`                                    // Client-assigned request id, echoed in the response and worker logs
+	Iterations int64                  `protobuf:"varint,4,opt,name=iterations,proto3" json:"iterations,omitempty"`                   // If > 0, "full" mode runs exactly this many spin iterations instead of spinning for duration_ms
+	Cores      int32                  `protobuf:"varint,5,opt,name=cores,proto3" json:"cores,omitempty"`                             // Number of parallel spin threads for "full" mode (default 1)
+	// Payload padding, to make the data plane carry real bytes
+	RequestPadBytes []byte `protobuf:"bytes,6,opt,name=request_pad_bytes,json=requestPadBytes,proto3" json:"request_pad_bytes,omitempty"`  // Opaque padding sent by the client, ignored by the worker
+	ResponsePadSize int32  `protobuf:"varint,7,opt,name=response_pad_size,json=responsePadSize,proto3" json:"response_pad_size,omitempty"` // Number of padding bytes the worker returns in response_pad_bytes
+	TargetUtilPct   int32  `protobuf:"varint,8,opt,name=target_util_pct,json=targetUtilPct,proto3" json:"target_util_pct,omitempty"`       // If 1-99, "full" mode alternates spin and sleep over duration_ms to average this CPU utilization
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
 }
 
 func (x *WorkRequest) Reset() {
@@ -74,6 +81,48 @@ func (x *WorkRequest) GetWorkMode() string {
 	return ""
 }
 
+func (x *WorkRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *WorkRequest) GetIterations() int64 {
+	if x != nil {
+		return x.Iterations
+	}
+	return 0
+}
+
+func (x *WorkRequest) GetCores() int32 {
+	if x != nil {
+		return x.Cores
+	}
+	return 0
+}
+
+func (x *WorkRequest) GetRequestPadBytes() []byte {
+	if x != nil {
+		return x.RequestPadBytes
+	}
+	return nil
+}
+
+func (x *WorkRequest) GetResponsePadSize() int32 {
+	if x != nil {
+		return x.ResponsePadSize
+	}
+	return 0
+}
+
+func (x *WorkRequest) GetTargetUtilPct() int32 {
+	if x != nil {
+		return x.TargetUtilPct
+	}
+	return 0
+}
+
 // Response from Worker
 type WorkResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -87,8 +136,21 @@ type WorkResponse struct {
 	PostBusyTimestampNs int64 `protobuf:"varint,7,opt,name=post_busy_timestamp_ns,json=postBusyTimestampNs,proto3" json:"post_busy_timestamp_ns,omitempty"` // Time after busy work completes
 	ResponseTimestampNs int64 `protobuf:"varint,8,opt,name=response_timestamp_ns,json=responseTimestampNs,proto3" json:"response_timestamp_ns,omitempty"`   // Time when response is sent
 	WorkerProcessingNs  int64 `protobuf:"varint,9,opt,name=worker_processing_ns,json=workerProcessingNs,proto3" json:"worker_processing_ns,omitempty"`      // Total worker processing time (post_busy - pre_busy)
-	unknownFields       protoimpl.UnknownFields
-	sizeCache           protoimpl.SizeCache
+	// CPU frequency spread over the request, to detect throttling hidden by the average
+	MinCpuFreqKhz    int64   `protobuf:"varint,10,opt,name=min_cpu_freq_khz,json=minCpuFreqKhz,proto3" json:"min_cpu_freq_khz,omitempty"`        // Lowest sampled CPU frequency (in kHz)
+	MaxCpuFreqKhz    int64   `protobuf:"varint,11,opt,name=max_cpu_freq_khz,json=maxCpuFreqKhz,proto3" json:"max_cpu_freq_khz,omitempty"`        // Highest sampled CPU frequency (in kHz)
+	P5CpuFreqKhz     int64   `protobuf:"varint,12,opt,name=p5_cpu_freq_khz,json=p5CpuFreqKhz,proto3" json:"p5_cpu_freq_khz,omitempty"`           // 5th percentile of sampled CPU frequency (in kHz)
+	Id               string  `protobuf:"bytes,13,opt,name=id,proto3" json:"id,omitempty"`                                                        // Request id echoed from WorkRequest
+	CoreIterations   []int64 `protobuf:"varint,14,rep,packed,name=core_iterations,json=coreIterations,proto3" json:"core_iterations,omitempty"`  // Per-core iteration counts when cores > 1 (iterations holds the total)
+	ResponsePadBytes []byte  `protobuf:"bytes,15,opt,name=response_pad_bytes,json=responsePadBytes,proto3" json:"response_pad_bytes,omitempty"`  // Padding of the size requested in response_pad_size
+	WorkerCpuTimeMs  float64 `protobuf:"fixed64,16,opt,name=worker_cpu_time_ms,json=workerCpuTimeMs,proto3" json:"worker_cpu_time_ms,omitempty"` // Thread CPU time consumed by the spin loop(s); wall >> cpu means the worker was descheduled
+	// Which replica served the request, to check load balancing across endpoints
+	WorkerInstance   string  `protobuf:"bytes,17,opt,name=worker_instance,json=workerInstance,proto3" json:"worker_instance,omitempty"`          // WORKER_INSTANCE env, else the pod hostname
+	NodeName         string  `protobuf:"bytes,18,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`                            // NODE_NAME env (downward API spec.nodeName), empty if unset
+	AchievedUtilPct  float64 `protobuf:"fixed64,19,opt,name=achieved_util_pct,json=achievedUtilPct,proto3" json:"achieved_util_pct,omitempty"`   // "full" mode: spin CPU time / (processing time * cores); 0 where CPU time is unavailable
+	CpuFreqAvailable bool    `protobuf:"varint,20,opt,name=cpu_freq_available,json=cpuFreqAvailable,proto3" json:"cpu_freq_available,omitempty"` // False when no cpufreq sample backs the *_cpu_freq_khz fields (unreadable cpufreq, "sleep" mode); they are then N/A, not 0 kHz
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
 }
 
 func (x *WorkResponse) Reset() {
@@ -184,15 +246,267 @@ func (x *WorkResponse) GetWorkerProcessingNs() int64 {
 	return 0
 }
 
+func (x *WorkResponse) GetMinCpuFreqKhz() int64 {
+	if x != nil {
+		return x.MinCpuFreqKhz
+	}
+	return 0
+}
+
+func (x *WorkResponse) GetMaxCpuFreqKhz() int64 {
+	if x != nil {
+		return x.MaxCpuFreqKhz
+	}
+	return 0
+}
+
+func (x *WorkResponse) GetP5CpuFreqKhz() int64 {
+	if x != nil {
+		return x.P5CpuFreqKhz
+	}
+	return 0
+}
+
+func (x *WorkResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *WorkResponse) GetCoreIterations() []int64 {
+	if x != nil {
+		return x.CoreIterations
+	}
+	return nil
+}
+
+func (x *WorkResponse) GetResponsePadBytes() []byte {
+	if x != nil {
+		return x.ResponsePadBytes
+	}
+	return nil
+}
+
+func (x *WorkResponse) GetWorkerCpuTimeMs() float64 {
+	if x != nil {
+		return x.WorkerCpuTimeMs
+	}
+	return 0
+}
+
+func (x *WorkResponse) GetWorkerInstance() string {
+	if x != nil {
+		return x.WorkerInstance
+	}
+	return ""
+}
+
+func (x *WorkResponse) GetNodeName() string {
+	if x != nil {
+		return x.NodeName
+	}
+	return ""
+}
+
+func (x *WorkResponse) GetAchievedUtilPct() float64 {
+	if x != nil {
+		return x.AchievedUtilPct
+	}
+	return 0
+}
+
+func (x *WorkResponse) GetCpuFreqAvailable() bool {
+	if x != nil {
+		return x.CpuFreqAvailable
+	}
+	return false
+}
+
+// Streaming request: repeat the same work and reply once per completed tick
+type StreamRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Work          *WorkRequest           `protobuf:"bytes,1,opt,name=work,proto3" json:"work,omitempty"`                                   // Work performed for every message
+	NumMessages   int32                  `protobuf:"varint,2,opt,name=num_messages,json=numMessages,proto3" json:"num_messages,omitempty"` // Number of replies to send (0 = until the client cancels)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamRequest) Reset() {
+	*x = StreamRequest{}
+	mi := &file_worker_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamRequest) ProtoMessage() {}
+
+func (x *StreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_worker_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamRequest.ProtoReflect.Descriptor instead.
+func (*StreamRequest) Descriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StreamRequest) GetWork() *WorkRequest {
+	if x != nil {
+		return x.Work
+	}
+	return nil
+}
+
+func (x *StreamRequest) GetNumMessages() int32 {
+	if x != nil {
+		return x.NumMessages
+	}
+	return 0
+}
+
+type NodeStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NodeStatsRequest) Reset() {
+	*x = NodeStatsRequest{}
+	mi := &file_worker_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeStatsRequest) ProtoMessage() {}
+
+func (x *NodeStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_worker_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeStatsRequest.ProtoReflect.Descriptor instead.
+func (*NodeStatsRequest) Descriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{3}
+}
+
+// Conntrack occupancy as seen from the worker's network namespace; run the
+// worker with hostNetwork for node-wide counts.
+type NodeStatsResponse struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	ConntrackAvailable bool                   `protobuf:"varint,1,opt,name=conntrack_available,json=conntrackAvailable,proto3" json:"conntrack_available,omitempty"` // False if /proc/sys/net/netfilter is not readable
+	ConntrackCount     int64                  `protobuf:"varint,2,opt,name=conntrack_count,json=conntrackCount,proto3" json:"conntrack_count,omitempty"`             // nf_conntrack_count
+	ConntrackMax       int64                  `protobuf:"varint,3,opt,name=conntrack_max,json=conntrackMax,proto3" json:"conntrack_max,omitempty"`                   // nf_conntrack_max
+	WorkerInstance     string                 `protobuf:"bytes,4,opt,name=worker_instance,json=workerInstance,proto3" json:"worker_instance,omitempty"`              // Replica that answered
+	TimestampNs        int64                  `protobuf:"varint,5,opt,name=timestamp_ns,json=timestampNs,proto3" json:"timestamp_ns,omitempty"`                      // Time the counters were read (nanoseconds since epoch)
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *NodeStatsResponse) Reset() {
+	*x = NodeStatsResponse{}
+	mi := &file_worker_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeStatsResponse) ProtoMessage() {}
+
+func (x *NodeStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_worker_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeStatsResponse.ProtoReflect.Descriptor instead.
+func (*NodeStatsResponse) Descriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *NodeStatsResponse) GetConntrackAvailable() bool {
+	if x != nil {
+		return x.ConntrackAvailable
+	}
+	return false
+}
+
+func (x *NodeStatsResponse) GetConntrackCount() int64 {
+	if x != nil {
+		return x.ConntrackCount
+	}
+	return 0
+}
+
+func (x *NodeStatsResponse) GetConntrackMax() int64 {
+	if x != nil {
+		return x.ConntrackMax
+	}
+	return 0
+}
+
+func (x *NodeStatsResponse) GetWorkerInstance() string {
+	if x != nil {
+		return x.WorkerInstance
+	}
+	return ""
+}
+
+func (x *NodeStatsResponse) GetTimestampNs() int64 {
+	if x != nil {
+		return x.TimestampNs
+	}
+	return 0
+}
+
 var File_worker_proto protoreflect.FileDescriptor
 
 const file_worker_proto_rawDesc = "" +
 	"\n" +
-	"\fworker.proto\x12\x06worker\"K\n" +
+	"\fworker.proto\x12\x06worker\"\x91\x02\n" +
 	"\vWorkRequest\x12\x1f\n" +
 	"\vduration_ms\x18\x01 \x01(\x05R\n" +
 	"durationMs\x12\x1b\n" +
-	"\twork_mode\x18\x02 \x01(\tR\bworkMode\"\x95\x03\n" +
+	"\twork_mode\x18\x02 \x01(\tR\bworkMode\x12\x0e\n" +
+	"\x02id\x18\x03 \x01(\tR\x02id\x12\x1e\n" +
+	"\n" +
+	"iterations\x18\x04 \x01(\x03R\n" +
+	"iterations\x12\x14\n" +
+	"\x05cores\x18\x05 \x01(\x05R\x05cores\x12*\n" +
+	"\x11request_pad_bytes\x18\x06 \x01(\fR\x0frequestPadBytes\x12*\n" +
+	"\x11response_pad_size\x18\a \x01(\x05R\x0fresponsePadSize\x12&\n" +
+	"\x0ftarget_util_pct\x18\b \x01(\x05R\rtargetUtilPct\"\xc2\x06\n" +
 	"\fWorkResponse\x12\x16\n" +
 	"\x06status\x18\x01 \x01(\tR\x06status\x12$\n" +
 	"\x0ee2e_latency_ms\x18\x02 \x01(\x03R\fe2eLatencyMs\x12'\n" +
@@ -204,9 +518,33 @@ const file_worker_proto_rawDesc = "" +
 	"\x15pre_busy_timestamp_ns\x18\x06 \x01(\x03R\x12preBusyTimestampNs\x123\n" +
 	"\x16post_busy_timestamp_ns\x18\a \x01(\x03R\x13postBusyTimestampNs\x122\n" +
 	"\x15response_timestamp_ns\x18\b \x01(\x03R\x13responseTimestampNs\x120\n" +
-	"\x14worker_processing_ns\x18\t \x01(\x03R\x12workerProcessingNs2D\n" +
+	"\x14worker_processing_ns\x18\t \x01(\x03R\x12workerProcessingNs\x12'\n" +
+	"\x10min_cpu_freq_khz\x18\n" +
+	" \x01(\x03R\rminCpuFreqKhz\x12'\n" +
+	"\x10max_cpu_freq_khz\x18\v \x01(\x03R\rmaxCpuFreqKhz\x12%\n" +
+	"\x0fp5_cpu_freq_khz\x18\f \x01(\x03R\fp5CpuFreqKhz\x12\x0e\n" +
+	"\x02id\x18\r \x01(\tR\x02id\x12'\n" +
+	"\x0fcore_iterations\x18\x0e \x03(\x03R\x0ecoreIterations\x12,\n" +
+	"\x12response_pad_bytes\x18\x0f \x01(\fR\x10responsePadBytes\x12+\n" +
+	"\x12worker_cpu_time_ms\x18\x10 \x01(\x01R\x0fworkerCpuTimeMs\x12'\n" +
+	"\x0fworker_instance\x18\x11 \x01(\tR\x0eworkerInstance\x12\x1b\n" +
+	"\tnode_name\x18\x12 \x01(\tR\bnodeName\x12*\n" +
+	"\x11achieved_util_pct\x18\x13 \x01(\x01R\x0fachievedUtilPct\x12,\n" +
+	"\x12cpu_freq_available\x18\x14 \x01(\bR\x10cpuFreqAvailable\"[\n" +
+	"\rStreamRequest\x12'\n" +
+	"\x04work\x18\x01 \x01(\v2\x13.worker.WorkRequestR\x04work\x12!\n" +
+	"\fnum_messages\x18\x02 \x01(\x05R\vnumMessages\"\x12\n" +
+	"\x10NodeStatsRequest\"\xde\x01\n" +
+	"\x11NodeStatsResponse\x12/\n" +
+	"\x13conntrack_available\x18\x01 \x01(\bR\x12conntrackAvailable\x12'\n" +
+	"\x0fconntrack_count\x18\x02 \x01(\x03R\x0econntrackCount\x12#\n" +
+	"\rconntrack_max\x18\x03 \x01(\x03R\fconntrackMax\x12'\n" +
+	"\x0fworker_instance\x18\x04 \x01(\tR\x0eworkerInstance\x12!\n" +
+	"\ftimestamp_ns\x18\x05 \x01(\x03R\vtimestampNs2\xc8\x01\n" +
 	"\rWorkerService\x123\n" +
-	"\x06DoWork\x12\x13.worker.WorkRequest\x1a\x14.worker.WorkResponseB\x15Z\x13./workerpb;workerpbb\x06proto3"
+	"\x06DoWork\x12\x13.worker.WorkRequest\x1a\x14.worker.WorkResponse\x12=\n" +
+	"\fDoWorkStream\x12\x15.worker.StreamRequest\x1a\x14.worker.WorkResponse0\x01\x12C\n" +
+	"\fGetNodeStats\x12\x18.worker.NodeStatsRequest\x1a\x19.worker.NodeStatsResponseB\x15Z\x13./workerpb;workerpbb\x06proto3"
 
 var (
 	file_worker_proto_rawDescOnce sync.Once
@@ -220,19 +558,27 @@ func file_worker_proto_rawDescGZIP() []byte {
 	return file_worker_proto_rawDescData
 }
 
-var file_worker_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_worker_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
 var file_worker_proto_goTypes = []any{
-	(*WorkRequest)(nil),  // 0: worker.WorkRequest
-	(*WorkResponse)(nil), // 1: worker.WorkResponse
+	(*WorkRequest)(nil),       // 0: worker.WorkRequest
+	(*WorkResponse)(nil),      // 1: worker.WorkResponse
+	(*StreamRequest)(nil),     // 2: worker.StreamRequest
+	(*NodeStatsRequest)(nil),  // 3: worker.NodeStatsRequest
+	(*NodeStatsResponse)(nil), // 4: worker.NodeStatsResponse
 }
 var file_worker_proto_depIdxs = []int32{
-	0, // 0: worker.WorkerService.DoWork:input_type -> worker.WorkRequest
-	1, // 1: worker.WorkerService.DoWork:output_type -> worker.WorkResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0, // 0: worker.StreamRequest.work:type_name -> worker.WorkRequest
+	0, // 1: worker.WorkerService.DoWork:input_type -> worker.WorkRequest
+	2, // 2: worker.WorkerService.DoWorkStream:input_type -> worker.StreamRequest
+	3, // 3: worker.WorkerService.GetNodeStats:input_type -> worker.NodeStatsRequest
+	1, // 4: worker.WorkerService.DoWork:output_type -> worker.WorkResponse
+	1, // 5: worker.WorkerService.DoWorkStream:output_type -> worker.WorkResponse
+	4, // 6: worker.WorkerService.GetNodeStats:output_type -> worker.NodeStatsResponse
+	4, // [4:7] is the sub-list for method output_type
+	1, // [1:4] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_worker_proto_init() }
@@ -246,7 +592,7 @@ func file_worker_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_worker_proto_rawDesc), len(file_worker_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   5,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
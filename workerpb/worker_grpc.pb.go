@@ -19,7 +19,9 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	WorkerService_DoWork_FullMethodName = "/worker.WorkerService/DoWork"
+	WorkerService_DoWork_FullMethodName       = "/worker.WorkerService/DoWork"
+	WorkerService_DoWorkStream_FullMethodName = "/worker.WorkerService/DoWorkStream"
+	WorkerService_GetNodeStats_FullMethodName = "/worker.WorkerService/GetNodeStats"
 )
 
 // WorkerServiceClient is the client API for WorkerService service.
@@ -29,6 +31,8 @@ const (
 // Service definition
 type WorkerServiceClient interface {
 	DoWork(ctx context.Context, in *WorkRequest, opts ...grpc.CallOption) (*WorkResponse, error)
+	DoWorkStream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WorkResponse], error)
+	GetNodeStats(ctx context.Context, in *NodeStatsRequest, opts ...grpc.CallOption) (*NodeStatsResponse, error)
 }
 
 type workerServiceClient struct {
@@ -49,6 +53,35 @@ func (c *workerServiceClient) DoWork(ctx context.Context, in *WorkRequest, opts
 	return out, nil
 }
 
+func (c *workerServiceClient) DoWorkStream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WorkResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WorkerService_ServiceDesc.Streams[0], WorkerService_DoWorkStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamRequest, WorkResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WorkerService_DoWorkStreamClient = grpc.ServerStreamingClient[WorkResponse]
+
+func (c *workerServiceClient) GetNodeStats(ctx context.Context, in *NodeStatsRequest, opts ...grpc.CallOption) (*NodeStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NodeStatsResponse)
+	err := c.cc.Invoke(ctx, WorkerService_GetNodeStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // WorkerServiceServer is the server API for WorkerService service.
 // All implementations must embed UnimplementedWorkerServiceServer
 // for forward compatibility.
@@ -56,6 +89,8 @@ func (c *workerServiceClient) DoWork(ctx context.Context, in *WorkRequest, opts
 // Service definition
 type WorkerServiceServer interface {
 	DoWork(context.Context, *WorkRequest) (*WorkResponse, error)
+	DoWorkStream(*StreamRequest, grpc.ServerStreamingServer[WorkResponse]) error
+	GetNodeStats(context.Context, *NodeStatsRequest) (*NodeStatsResponse, error)
 	mustEmbedUnimplementedWorkerServiceServer()
 }
 
@@ -69,6 +104,12 @@ type UnimplementedWorkerServiceServer struct{}
 func (UnimplementedWorkerServiceServer) DoWork(context.Context, *WorkRequest) (*WorkResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DoWork not implemented")
 }
+func (UnimplementedWorkerServiceServer) DoWorkStream(*StreamRequest, grpc.ServerStreamingServer[WorkResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method DoWorkStream not implemented")
+}
+func (UnimplementedWorkerServiceServer) GetNodeStats(context.Context, *NodeStatsRequest) (*NodeStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNodeStats not implemented")
+}
 func (UnimplementedWorkerServiceServer) mustEmbedUnimplementedWorkerServiceServer() {}
 func (UnimplementedWorkerServiceServer) testEmbeddedByValue()                       {}
 
@@ -108,6 +149,35 @@ func _WorkerService_DoWork_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _WorkerService_DoWorkStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WorkerServiceServer).DoWorkStream(m, &grpc.GenericServerStream[StreamRequest, WorkResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WorkerService_DoWorkStreamServer = grpc.ServerStreamingServer[WorkResponse]
+
+func _WorkerService_GetNodeStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodeStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WorkerServiceServer).GetNodeStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WorkerService_GetNodeStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WorkerServiceServer).GetNodeStats(ctx, req.(*NodeStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // WorkerService_ServiceDesc is the grpc.ServiceDesc for WorkerService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -119,7 +189,17 @@ var WorkerService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DoWork",
 			Handler:    _WorkerService_DoWork_Handler,
 		},
+		{
+			MethodName: "GetNodeStats",
+			Handler:    _WorkerService_GetNodeStats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "DoWorkStream",
+			Handler:       _WorkerService_DoWorkStream_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "worker.proto",
 }